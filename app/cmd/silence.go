@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/glendsoza/sprobe/prober"
+	"github.com/glendsoza/sprobe/spec"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	silenceAddress  string
+	silenceDuration time.Duration
+	silenceProbing  bool
+	silenceComment  string
+)
+
+func init() {
+	silenceCmd.PersistentFlags().StringVar(&silenceAddress, "address", defaultAPIAddress, "unix socket path or host:port of the api of the running sprobe")
+	silenceAddCmd.Flags().DurationVarP(&silenceDuration, "duration", "d", time.Hour, "how long the services stay silenced")
+	silenceAddCmd.Flags().BoolVar(&silenceProbing, "probing", false, "stop probing the services as well, instead of only holding back remediation")
+	silenceAddCmd.Flags().StringVar(&silenceComment, "comment", "", "why the services are silenced, e.g. a deploy")
+	silenceCmd.AddCommand(silenceAddCmd, silenceListCmd, silenceExpireCmd)
+	rootCmd.AddCommand(silenceCmd)
+}
+
+var silenceCmd = &cobra.Command{
+	Use:   "silence",
+	Short: "Manage the silences of a running sprobe",
+	Long:  `Silenced services are not remediated, e.g. while they are deployed, and with --probing not probed either.`,
+}
+
+var silenceAddCmd = &cobra.Command{
+	Use:   "add <service or glob>",
+	Short: "Silence the services matching a name or glob such as 'web-*.service'",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		req := prober.SilenceRequest{
+			Silence:         spec.Silence{Services: args[0], Scope: "remediation", Comment: silenceComment},
+			DurationSeconds: int(silenceDuration.Round(time.Second).Seconds()),
+		}
+		if silenceProbing {
+			req.Scope = "probing"
+		}
+		body, err := json.Marshal(req)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to encode the silence")
+		}
+		var silence prober.Silence
+		silenceRequest(http.MethodPost, "/silences", body, http.StatusCreated, &silence)
+		printSilences([]*prober.Silence{&silence})
+	},
+}
+
+var silenceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the silences in effect",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var silences []*prober.Silence
+		silenceRequest(http.MethodGet, "/silences", nil, http.StatusOK, &silences)
+		printSilences(silences)
+	},
+}
+
+var silenceExpireCmd = &cobra.Command{
+	Use:   "expire <id>",
+	Short: "End a silence before its time",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		silenceRequest(http.MethodDelete, "/silences/"+url.PathEscape(args[0]), nil, http.StatusNoContent, nil)
+	},
+}
+
+// silenceRequest calls the silences API of sprobe and decodes the response
+// into v unless v is nil.
+func silenceRequest(method string, path string, body []byte, wantCode int, v any) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	baseURL := "http://" + silenceAddress
+	if isSocket(silenceAddress) {
+		// the host of the url is ignored, every request goes to the socket
+		baseURL = "http://sprobe"
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", silenceAddress)
+			},
+		}
+	}
+	req, err := http.NewRequest(method, baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		log.Fatal().Str("address", silenceAddress).Err(err).Msg("invalid request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Fatal().Str("address", silenceAddress).Err(err).Msg("unable to reach sprobe")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantCode {
+		message, _ := io.ReadAll(resp.Body)
+		log.Fatal().Str("address", silenceAddress).
+			Int("status_code", resp.StatusCode).
+			Str("output", strings.TrimSpace(string(message))).
+			Msg("request failed")
+	}
+	if v == nil {
+		return
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		log.Fatal().Str("address", silenceAddress).Err(err).Msg("invalid response")
+	}
+}
+
+func printSilences(silences []*prober.Silence) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSERVICES\tSCOPE\tUNTIL\tSCHEDULE\tCOMMENT")
+	for _, s := range silences {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Services, s.Scope, s.Until.Local().Format(time.RFC3339), s.Schedule, s.Comment)
+	}
+	w.Flush()
+}
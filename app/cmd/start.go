@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 
 	"github.com/glendsoza/sprobe/prober"
 	"github.com/glendsoza/sprobe/spec"
+	"github.com/glendsoza/sprobe/sysd"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 
@@ -14,7 +18,20 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+var (
+	stateFile       string
+	maintenanceFile string
+	apiAddress      string
+)
+
+// defaultAPIAddress is the unix socket the silences API is served on, only
+// reachable by root.
+const defaultAPIAddress = "/run/sprobe/api.sock"
+
 func init() {
+	startCmd.Flags().StringVar(&stateFile, "state-file", "/var/lib/sprobe/restarts.json", "file keeping the restart history across restarts of sprobe, silences are kept next to it in silences.json, empty to keep both in memory")
+	startCmd.Flags().StringVar(&maintenanceFile, "maintenance", "", "file listing recurring maintenance windows during which services are silenced")
+	startCmd.Flags().StringVar(&apiAddress, "api", defaultAPIAddress, "unix socket path or host:port the silences API is served on")
 	rootCmd.AddCommand(startCmd)
 }
 
@@ -39,12 +56,31 @@ var startCmd = &cobra.Command{
 				Err(err).
 				Msg("error loading the file")
 		}
-		sp, err := prober.NewProberManager(prober.NewServiceProber())
+		units, err := sysd.New()
 		if err != nil {
 			log.Fatal().
 				Str("file_name", config.Value.String()).
 				Err(err).
-				Msg("unable to create prober manager")
+				Msg("unable to connect to systemd")
+		}
+		sp := prober.NewProberManager(prober.NewServiceProber(units), units)
+		if stateFile != "" {
+			if err := sp.LoadRestartState(stateFile); err != nil {
+				log.Fatal().
+					Str("file_name", stateFile).
+					Err(err).
+					Msg("unable to load the restart state")
+			}
+			silencesFile := filepath.Join(filepath.Dir(stateFile), "silences.json")
+			if err := sp.LoadSilences(silencesFile); err != nil {
+				log.Fatal().
+					Str("file_name", silencesFile).
+					Err(err).
+					Msg("unable to load the silences")
+			}
+		}
+		if maintenanceFile != "" {
+			loadMaintenanceWindows(sp, maintenanceFile)
 		}
 		for _, spec := range specs {
 			err := sp.Add(spec)
@@ -59,14 +95,100 @@ var startCmd = &cobra.Command{
 					Msg("loaded service for monitoring")
 			}
 		}
+		events, err := units.Watch(context.Background())
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Msg("unable to subscribe to systemd unit events, relying on probes only")
+		} else {
+			go sp.HandleUnitEvents(events)
+		}
 		log.Info().Str("file_name", config.Value.String()).Msg("monitoring")
 		go func() {
 			http.Handle("/metrics", promhttp.Handler())
 			http.ListenAndServe(":2112", nil)
 		}()
+		go serveAPI(sp, apiAddress)
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt)
 		<-c
 		log.Info().Str("file_name", config.Value.String()).Msg("stopping monitoring, received sig int")
 	},
 }
+
+func loadMaintenanceWindows(sp *prober.ProberManager, fileName string) {
+	fileData, err := os.ReadFile(fileName)
+	if err != nil {
+		log.Fatal().
+			Str("file_name", fileName).
+			Err(err).
+			Msg("unable to read the file")
+	}
+	var windows []*spec.MaintenanceWindow
+	if err := yaml.Unmarshal(fileData, &windows); err != nil {
+		log.Fatal().
+			Str("file_name", fileName).
+			Err(err).
+			Msg("error loading the file")
+	}
+	for _, window := range windows {
+		if err := sp.AddMaintenanceWindow(window); err != nil {
+			log.Fatal().
+				Str("file_name", fileName).
+				Err(err).
+				Msg("unable to load the maintenance window")
+		}
+		log.Info().Str("file_name", fileName).
+			Str("services", window.Services).
+			Str("schedule", window.Schedule).
+			Msg("loaded maintenance window")
+	}
+}
+
+// serveAPI serves the silences API apart from the metrics, on a unix socket
+// readable by root only or on a host:port.
+func serveAPI(sp *prober.ProberManager, address string) {
+	listener, err := listenAPI(address)
+	if err != nil {
+		log.Fatal().
+			Str("address", address).
+			Err(err).
+			Msg("unable to serve the api")
+	}
+	mux := http.NewServeMux()
+	sp.HandleSilences(mux)
+	if err := http.Serve(listener, mux); err != nil {
+		log.Error().
+			Str("address", address).
+			Err(err).
+			Msg("api stopped")
+	}
+}
+
+func listenAPI(address string) (net.Listener, error) {
+	if !isSocket(address) {
+		return net.Listen("tcp", address)
+	}
+	if err := os.MkdirAll(filepath.Dir(address), 0755); err != nil {
+		return nil, err
+	}
+	// a socket left behind by a previous run fails the listen
+	if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// isSocket reports whether address is the path of a unix socket rather than
+// a host:port.
+func isSocket(address string) bool {
+	return filepath.IsAbs(address)
+}
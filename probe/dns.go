@@ -0,0 +1,270 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return rcode.String()
+}
+
+type DNSExpectations struct {
+	Rcode dnsmessage.RCode
+	// RequireAnswer fails responses without a record of the queried type
+	RequireAnswer bool
+	// Values must each be among the answers, e.g. "192.0.2.1" for A records or
+	// "10 mail.example.com." for MX records
+	Values []string
+	// MaxLatency of zero disables the latency check
+	MaxLatency time.Duration
+}
+
+type DnsProbe interface {
+	Probe(server string, network string, name string, qtype dnsmessage.Type, expect DNSExpectations, timeout time.Duration) (status.Status, string, error)
+}
+
+type dnsProbe struct {
+	resolvConf string
+}
+
+func NewDnsProbe() DnsProbe {
+	return dnsProbe{resolvConf: "/etc/resolv.conf"}
+}
+
+// Probe sends a recursive query for name to server over network ("udp" or
+// "tcp") and checks the response against expect. An empty server queries the
+// first nameserver of resolv.conf, usually the local stub resolver.
+func (pr dnsProbe) Probe(server string, network string, name string, qtype dnsmessage.Type, expect DNSExpectations, timeout time.Duration) (status.Status, string, error) {
+	if server == "" {
+		server = defaultDNSServer(pr.resolvConf)
+	}
+	query, id, err := buildDNSQuery(name, qtype)
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	start := time.Now()
+	resp, err := exchangeDNS(network, server, query, timeout)
+	latency := time.Since(start)
+	if err != nil {
+		return status.Failure, err.Error(), nil
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(resp)
+	if err != nil {
+		return status.Failure, fmt.Sprintf("malformed response: %v", err), nil
+	}
+	if header.ID != id {
+		return status.Failure, fmt.Sprintf("response id %d does not match query id %d", header.ID, id), nil
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return status.Failure, fmt.Sprintf("malformed response: %v", err), nil
+	}
+	answers, err := dnsAnswers(&p, qtype)
+	if err != nil {
+		return status.Failure, fmt.Sprintf("malformed response: %v", err), nil
+	}
+
+	output := fmt.Sprintf("%s %s from %s in %v: rcode=%s answers=[%s]",
+		name, strings.TrimPrefix(qtype.String(), "Type"), server, latency.Round(time.Microsecond),
+		rcodeName(header.RCode), strings.Join(answers, ", "))
+	if header.RCode != expect.Rcode {
+		return status.Failure, fmt.Sprintf("expected rcode %s, %s", rcodeName(expect.Rcode), output), nil
+	}
+	if expect.RequireAnswer && len(answers) == 0 {
+		return status.Failure, fmt.Sprintf("no answer, %s", output), nil
+	}
+	for _, v := range expect.Values {
+		if !slices.ContainsFunc(answers, func(a string) bool { return dnsValueEqual(a, v) }) {
+			return status.Failure, fmt.Sprintf("expected answer %q not found, %s", v, output), nil
+		}
+	}
+	if expect.MaxLatency > 0 && latency > expect.MaxLatency {
+		return status.Failure, fmt.Sprintf("response took longer than %v, %s", expect.MaxLatency, output), nil
+	}
+	return status.Success, output, nil
+}
+
+func buildDNSQuery(name string, qtype dnsmessage.Type) ([]byte, uint16, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	msg, err := b.Finish()
+	return msg, id, err
+}
+
+// exchangeDNS sends query and reads the response; over TCP both are prefixed
+// with their length as per RFC 1035 section 4.2.2.
+func exchangeDNS(network string, server string, query []byte, timeout time.Duration) ([]byte, error) {
+	conn, err := net.DialTimeout(network, server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if network == "tcp" {
+		msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(msg, query...)); err != nil {
+			return nil, err
+		}
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, length)
+		_, err := io.ReadFull(conn, resp)
+		return resp, err
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 65535)
+	n, err := conn.Read(resp)
+	return resp[:n], err
+}
+
+// dnsAnswers returns the answers of type qtype in their presentation format.
+func dnsAnswers(p *dnsmessage.Parser, qtype dnsmessage.Type) ([]string, error) {
+	var answers []string
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			return answers, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Type != qtype {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var value string
+		switch qtype {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return nil, err
+			}
+			value = net.IP(r.A[:]).String()
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return nil, err
+			}
+			value = net.IP(r.AAAA[:]).String()
+		case dnsmessage.TypeCNAME:
+			r, err := p.CNAMEResource()
+			if err != nil {
+				return nil, err
+			}
+			value = r.CNAME.String()
+		case dnsmessage.TypeMX:
+			r, err := p.MXResource()
+			if err != nil {
+				return nil, err
+			}
+			value = fmt.Sprintf("%d %s", r.Pref, r.MX)
+		case dnsmessage.TypeNS:
+			r, err := p.NSResource()
+			if err != nil {
+				return nil, err
+			}
+			value = r.NS.String()
+		case dnsmessage.TypePTR:
+			r, err := p.PTRResource()
+			if err != nil {
+				return nil, err
+			}
+			value = r.PTR.String()
+		case dnsmessage.TypeSOA:
+			r, err := p.SOAResource()
+			if err != nil {
+				return nil, err
+			}
+			value = fmt.Sprintf("%s %s %d", r.NS, r.MBox, r.Serial)
+		case dnsmessage.TypeSRV:
+			r, err := p.SRVResource()
+			if err != nil {
+				return nil, err
+			}
+			value = fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target)
+		case dnsmessage.TypeTXT:
+			r, err := p.TXTResource()
+			if err != nil {
+				return nil, err
+			}
+			value = strings.Join(r.TXT, "")
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		answers = append(answers, value)
+	}
+}
+
+// dnsValueEqual compares names case-insensitively and regardless of the
+// trailing dot, so "mail.example.com" matches "mail.example.com.".
+func dnsValueEqual(answer string, expected string) bool {
+	if answer == expected {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSuffix(answer, "."), strings.TrimSuffix(expected, "."))
+}
+
+func defaultDNSServer(resolvConf string) string {
+	f, err := os.Open(resolvConf)
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
@@ -0,0 +1,133 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsAnswer builds the response to query: example.com has the A record
+// 192.0.2.1 and an MX record, every other name is NXDOMAIN.
+func dnsAnswer(t *testing.T, query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	assert.NoError(t, err)
+	q, err := p.Question()
+	assert.NoError(t, err)
+
+	header.Response = true
+	b := dnsmessage.NewBuilder(nil, header)
+	assert.NoError(t, b.StartQuestions())
+	assert.NoError(t, b.Question(q))
+	assert.NoError(t, b.StartAnswers())
+	if q.Name.String() != "example.com." {
+		header.RCode = dnsmessage.RCodeNameError
+		b = dnsmessage.NewBuilder(nil, header)
+		assert.NoError(t, b.StartQuestions())
+		assert.NoError(t, b.Question(q))
+	} else {
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		switch q.Type {
+		case dnsmessage.TypeA:
+			assert.NoError(t, b.AResource(rh, dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}))
+		case dnsmessage.TypeMX:
+			assert.NoError(t, b.MXResource(rh, dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")}))
+		}
+	}
+	resp, err := b.Finish()
+	assert.NoError(t, err)
+	return resp
+}
+
+func startDNSServer(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(dnsAnswer(t, buf[:n]), addr)
+		}
+	}()
+
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var length uint16
+			if binary.Read(conn, binary.BigEndian, &length) == nil {
+				query := make([]byte, length)
+				if _, err := io.ReadFull(conn, query); err == nil {
+					resp := dnsAnswer(t, query)
+					conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestDNSProbe(t *testing.T) {
+	server := startDNSServer(t)
+	tests := []struct {
+		name           string
+		network        string
+		qname          string
+		qtype          dnsmessage.Type
+		expect         DNSExpectations
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"a record", "udp", "example.com", dnsmessage.TypeA, DNSExpectations{RequireAnswer: true, Values: []string{"192.0.2.1"}}, status.Success, "rcode=NOERROR answers=[192.0.2.1]"},
+		{"tcp", "tcp", "example.com", dnsmessage.TypeA, DNSExpectations{RequireAnswer: true}, status.Success, "answers=[192.0.2.1]"},
+		{"mx record", "udp", "example.com", dnsmessage.TypeMX, DNSExpectations{Values: []string{"10 MAIL.example.com"}}, status.Success, "answers=[10 mail.example.com.]"},
+		{"unexpected value", "udp", "example.com", dnsmessage.TypeA, DNSExpectations{Values: []string{"192.0.2.2"}}, status.Failure, `expected answer "192.0.2.2" not found`},
+		{"no answer", "udp", "example.com", dnsmessage.TypeAAAA, DNSExpectations{RequireAnswer: true}, status.Failure, "no answer"},
+		{"nxdomain", "udp", "missing.example.com", dnsmessage.TypeA, DNSExpectations{}, status.Failure, "expected rcode NOERROR"},
+		{"expected nxdomain", "udp", "missing.example.com", dnsmessage.TypeA, DNSExpectations{Rcode: dnsmessage.RCodeNameError}, status.Success, "rcode=NXDOMAIN"},
+		{"latency", "udp", "example.com", dnsmessage.TypeA, DNSExpectations{MaxLatency: time.Nanosecond}, status.Failure, "response took longer than 1ns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := NewDnsProbe().Probe(server, tt.network, tt.qname, tt.qtype, tt.expect, time.Second)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
+
+func TestDNSProbeNoServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	s, _, err := NewDnsProbe().Probe(addr, "tcp", "example.com", dnsmessage.TypeA, DNSExpectations{}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+}
+
+func TestDefaultDNSServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.NoError(t, os.WriteFile(path, []byte("# generated\nsearch example.com\nnameserver 127.0.0.53\nnameserver ::1\n"), 0644))
+	assert.Equal(t, "127.0.0.53:53", defaultDNSServer(path))
+	assert.Equal(t, "127.0.0.1:53", defaultDNSServer(filepath.Join(t.TempDir(), "missing")))
+}
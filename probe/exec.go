@@ -1,9 +1,20 @@
 package probe
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/glendsoza/sprobe/status"
 )
@@ -27,8 +38,147 @@ func (e *Cmd) SetStdout(w io.Writer) {
 	e.Cmd.Stdout = w
 }
 
+// ExecOptions configures the process started by an exec probe. Env is
+// appended to the environment of sprobe, so later entries win.
+type ExecOptions struct {
+	Env        []string
+	WorkingDir string
+	User       string
+	Group      string
+}
+
+// NewCmd prepares command to run in its own process group, so that the whole
+// group, including children spawned by scripts, is killed once ctx is done.
+func NewCmd(ctx context.Context, command []string, opts ExecOptions) (*Cmd, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), opts.Env...)
+	cmd.Dir = opts.WorkingDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if opts.User != "" || opts.Group != "" {
+		credential, err := lookupCredential(opts.User, opts.Group)
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr.Credential = credential
+	}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// a child that escaped the process group may still hold the output pipe
+	cmd.WaitDelay = time.Second
+	return &Cmd{Cmd: cmd}, nil
+}
+
+// lookupCredential resolves user and group names or ids. Without a group the
+// user's primary group is used.
+func lookupCredential(userName string, groupName string) (*syscall.Credential, error) {
+	credential := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			if u, err = user.LookupId(userName); err != nil {
+				return nil, fmt.Errorf("unknown user %q", userName)
+			}
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		credential.Uid, credential.Gid = uint32(uid), uint32(gid)
+		groupIds, err := u.GroupIds()
+		if err == nil {
+			for _, id := range groupIds {
+				if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+					credential.Groups = append(credential.Groups, uint32(g))
+				}
+			}
+		}
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return nil, fmt.Errorf("unknown group %q", groupName)
+			}
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		credential.Gid = uint32(gid)
+	}
+	return credential, nil
+}
+
+// ReadEnvFile reads KEY=VALUE lines in the format of systemd's
+// EnvironmentFile=. Blank lines and lines starting with # or ; are skipped and
+// values may be wrapped in single or double quotes.
+func ReadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, strings.TrimSpace(key)+"="+value)
+	}
+	return env, scanner.Err()
+}
+
+// limitedWriter keeps the first limit bytes written to it and discards the
+// rest without failing the writer, which would make the command fail.
+type limitedWriter struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	room := w.limit - w.buf.Len()
+	if room > 0 {
+		w.buf.Write(p[:min(len(p), room)])
+	}
+	if len(p) > room {
+		w.truncated = true
+	}
+	return len(p), nil
+}
+
 type ExecProbe interface {
-	Probe(e CmdWrapper) (status.Status, string, error)
+	Probe(e CmdWrapper, outputLimit int) (status.Status, string, error)
+	// ProbeNagios runs a plugin following the Nagios plugin API and returns
+	// the performance data it printed along with the result
+	ProbeNagios(e CmdWrapper, outputLimit int) (status.Status, string, []PerfData, error)
+	// ProbeJSON runs a command printing an ExecJSONResult and returns the
+	// metrics it reported along with the result
+	ProbeJSON(e CmdWrapper, outputLimit int) (status.Status, string, map[string]float64, error)
+}
+
+// ExecJSONResult is the output contract of exec probes with JSON output, e.g.
+// {"status":"warning","message":"queue is backing up","metrics":{"queue":42}}.
+// Without a status the exit code decides as usual.
+type ExecJSONResult struct {
+	Status  string             `json:"status"`
+	Message string             `json:"message"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+var execJSONStatuses = map[string]status.Status{
+	"success":  status.Success,
+	"ok":       status.Success,
+	"warning":  status.Warning,
+	"failure":  status.Failure,
+	"critical": status.Failure,
+	"unknown":  status.Unknown,
 }
 
 type execProbe struct{}
@@ -37,25 +187,115 @@ func NewExecProbe() ExecProbe {
 	return &execProbe{}
 }
 
-func (pr *execProbe) Probe(e CmdWrapper) (status.Status, string, error) {
-	writer := bytes.NewBuffer([]byte(""))
-	e.SetStderr(writer)
-	e.SetStdout(writer)
+// Probe runs e, capturing at most outputLimit bytes of its combined stdout and
+// stderr.
+func (pr *execProbe) Probe(e CmdWrapper, outputLimit int) (status.Status, string, error) {
+	data, exitCode, err := runCmd(e, outputLimit)
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	if exitCode != 0 {
+		return status.Failure, string(data), nil
+	}
+	return status.Success, string(data), nil
+}
+
+// ProbeNagios maps the exit codes 0 OK, 1 WARNING, 2 CRITICAL and 3 UNKNOWN
+// onto Success, Warning, Failure and Unknown. A plugin killed on timeout is a
+// Failure.
+func (pr *execProbe) ProbeNagios(e CmdWrapper, outputLimit int) (status.Status, string, []PerfData, error) {
+	data, exitCode, err := runCmd(e, outputLimit)
+	if err != nil {
+		return status.Unknown, "", nil, err
+	}
+	output, perfData := ParseNagiosOutput(string(data))
+	switch exitCode {
+	case 0:
+		return status.Success, output, perfData, nil
+	case 1:
+		return status.Warning, output, perfData, nil
+	case 2, -1:
+		return status.Failure, output, perfData, nil
+	default:
+		return status.Unknown, output, perfData, nil
+	}
+}
+
+// ProbeJSON reads the result from the JSON object printed by the command on
+// stdout. Output that is not such an object is a Failure, as is a command
+// killed on timeout whatever it printed. Stderr is kept apart, each up to
+// outputLimit, and becomes the message when the object has none.
+func (pr *execProbe) ProbeJSON(e CmdWrapper, outputLimit int) (status.Status, string, map[string]float64, error) {
+	stdout := &limitedWriter{limit: outputLimit}
+	stderr := &limitedWriter{limit: outputLimit}
+	exitCode, err := waitCmd(e, stdout, stderr)
+	if err != nil {
+		return status.Unknown, "", nil, err
+	}
+	errOutput := strings.TrimSpace(stderr.buf.String())
+	if stdout.truncated {
+		return status.Failure, joinOutput(fmt.Sprintf("JSON output exceeds %d bytes", outputLimit), errOutput), nil, nil
+	}
+	var result ExecJSONResult
+	if err := json.Unmarshal(bytes.TrimSpace(stdout.buf.Bytes()), &result); err != nil {
+		return status.Failure, joinOutput(fmt.Sprintf("invalid JSON output: %v: %s", err, stdout.buf.Bytes()), errOutput), nil, nil
+	}
+	if result.Message == "" {
+		result.Message = errOutput
+	}
+	if exitCode == -1 {
+		return status.Failure, result.Message, result.Metrics, nil
+	}
+	if result.Status == "" {
+		if exitCode != 0 {
+			return status.Failure, result.Message, result.Metrics, nil
+		}
+		return status.Success, result.Message, result.Metrics, nil
+	}
+	s, ok := execJSONStatuses[strings.ToLower(result.Status)]
+	if !ok {
+		return status.Unknown, fmt.Sprintf("unsupported status %q: %s", result.Status, result.Message), result.Metrics, nil
+	}
+	return s, result.Message, result.Metrics, nil
+}
+
+// runCmd runs e and returns its output and exit code, which is -1 when the
+// command was killed by a signal.
+func runCmd(e CmdWrapper, outputLimit int) ([]byte, int, error) {
+	writer := &limitedWriter{limit: outputLimit}
+	exitCode, err := waitCmd(e, writer, writer)
+	if err != nil {
+		return nil, 0, err
+	}
+	return writer.buf.Bytes(), exitCode, nil
+}
+
+// waitCmd runs e to completion and returns its exit code.
+func waitCmd(e CmdWrapper, stdout io.Writer, stderr io.Writer) (int, error) {
+	e.SetStderr(stderr)
+	e.SetStdout(stdout)
 	err := e.Start()
 	if err == nil {
 		err = e.Wait()
 	}
-	data := writer.Bytes()
+	// the command succeeded but left a child holding its output open
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
 
 	if err != nil {
 		exit, ok := err.(*exec.ExitError)
 		if ok {
-			if exit.ExitCode() == 0 {
-				return status.Success, string(data), nil
-			}
-			return status.Failure, string(data), nil
+			return exit.ExitCode(), nil
 		}
-		return status.Unknown, "", err
+		return 0, err
 	}
-	return status.Success, string(data), nil
+	return 0, nil
+}
+
+func joinOutput(output string, errOutput string) string {
+	if errOutput == "" {
+		return output
+	}
+	return output + "; stderr: " + errOutput
 }
@@ -17,11 +17,17 @@ limitations under the License.
 package probe
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"github.com/glendsoza/sprobe/status"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -50,6 +56,8 @@ func (f *FakeCmd) Start() error {
 
 func (f *FakeCmd) Wait() error { return nil }
 
+const testOutputLimit = 10 * 1024
+
 func TestExec(t *testing.T) {
 	prober := NewExecProbe()
 
@@ -70,10 +78,10 @@ func TestExec(t *testing.T) {
 
 	for _, test := range tests {
 		fake := &FakeCmd{
-			out: []byte(test.output),
+			out: []byte(test.input),
 			err: test.err,
 		}
-		status, output, err := prober.Probe(fake)
+		status, output, err := prober.Probe(fake, testOutputLimit)
 		assert.Equal(t, test.expectedStatus, status)
 		if err != nil {
 			assert.Equal(t, test.err, err)
@@ -86,3 +94,129 @@ func TestExec(t *testing.T) {
 		}
 	}
 }
+
+func TestExecCmd(t *testing.T) {
+	dir := t.TempDir()
+	cmd, err := NewCmd(context.Background(), []string{"sh", "-c", "echo $PROBE_VAR; pwd"}, ExecOptions{
+		Env:        []string{"PROBE_VAR=one", "PROBE_VAR=two"},
+		WorkingDir: dir,
+	})
+	assert.NoError(t, err)
+	s, output, err := NewExecProbe().Probe(cmd, testOutputLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Success, s)
+	assert.Equal(t, "two\n"+dir+"\n", output)
+
+	cmd, err = NewCmd(context.Background(), []string{"sh", "-c", "yes | head -c 100000; exit 3"}, ExecOptions{})
+	assert.NoError(t, err)
+	s, output, err = NewExecProbe().Probe(cmd, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Equal(t, strings.Repeat("y\n", 8), output)
+
+	_, err = NewCmd(context.Background(), []string{"true"}, ExecOptions{User: "no-such-user-sprobe"})
+	assert.ErrorContains(t, err, "unknown user")
+}
+
+func TestExecKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	cmd, err := NewCmd(ctx, []string{"sh", "-c", "sleep 30 & echo $! > " + pidFile + "; wait"}, ExecOptions{})
+	assert.NoError(t, err)
+	start := time.Now()
+	s, _, _ := NewExecProbe().Probe(cmd, testOutputLimit)
+	assert.NotEqual(t, status.Success, s)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	data, err := os.ReadFile(pidFile)
+	assert.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		// the orphaned child may linger as a zombie until it is reaped
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env")
+	assert.NoError(t, os.WriteFile(path, []byte("# comment\n\nA=1\nexport B = \"two words\"\n; other\nC='3'\nD=\n"), 0644))
+	env, err := ReadEnvFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A=1", "B=two words", "C=3", "D="}, env)
+
+	assert.NoError(t, os.WriteFile(path, []byte("A=1\nbroken\n"), 0644))
+	_, err = ReadEnvFile(path)
+	assert.ErrorContains(t, err, ":2: expected KEY=VALUE")
+}
+
+func TestExecNagios(t *testing.T) {
+	tests := []struct {
+		script         string
+		expectedStatus status.Status
+	}{
+		{"echo 'OK | load=0.5'", status.Success},
+		{"echo 'WARNING | load=1.5'; exit 1", status.Warning},
+		{"echo 'CRITICAL | load=9'; exit 2", status.Failure},
+		{"echo 'UNKNOWN'; exit 3", status.Unknown},
+		{"exit 4", status.Unknown},
+	}
+	for _, tt := range tests {
+		cmd, err := NewCmd(context.Background(), []string{"sh", "-c", tt.script}, ExecOptions{})
+		assert.NoError(t, err)
+		s, output, _, err := NewExecProbe().ProbeNagios(cmd, testOutputLimit)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expectedStatus, s, tt.script)
+		assert.NotContains(t, output, "|")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cmd, err := NewCmd(ctx, []string{"sleep", "10"}, ExecOptions{})
+	assert.NoError(t, err)
+	s, _, _, err := NewExecProbe().ProbeNagios(cmd, testOutputLimit)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+}
+
+func TestExecJSON(t *testing.T) {
+	tests := []struct {
+		name            string
+		script          string
+		expectedStatus  status.Status
+		expectedOutput  string
+		expectedMetrics map[string]float64
+	}{
+		{"warning", `echo '{"status":"warning","message":"queue is backing up","metrics":{"queue":42}}'`, status.Warning, "queue is backing up", map[string]float64{"queue": 42}},
+		{"status wins over exit code", `echo '{"status":"OK","message":"fine"}'; exit 1`, status.Success, "fine", nil},
+		{"critical", `echo '{"status":"critical"}'`, status.Failure, "", nil},
+		{"exit code without status", `echo '{"message":"down"}'; exit 2`, status.Failure, "down", nil},
+		{"zero exit code without status", `echo '{"message":"up"}'`, status.Success, "up", nil},
+		{"unsupported status", `echo '{"status":"meh"}'`, status.Unknown, `unsupported status "meh"`, nil},
+		{"invalid output", `echo 'not json'`, status.Failure, "invalid JSON output", nil},
+		{"stderr is not decoded", `echo 'deprecated flag' >&2; echo '{"status":"ok","message":"fine"}'`, status.Success, "fine", nil},
+		{"stderr as message", `echo 'disk is full' >&2; echo '{"status":"critical"}'`, status.Failure, "disk is full", nil},
+		{"stderr of invalid output", `echo 'boom' >&2; exit 2`, status.Failure, "stderr: boom", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := NewCmd(context.Background(), []string{"sh", "-c", tt.script}, ExecOptions{})
+			assert.NoError(t, err)
+			s, output, metrics, err := NewExecProbe().ProbeJSON(cmd, testOutputLimit)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+			assert.Equal(t, tt.expectedMetrics, metrics)
+		})
+	}
+
+	// a truncated object cannot be decoded, whatever was left out
+	cmd, err := NewCmd(context.Background(), []string{"sh", "-c", `echo '{"status":"ok","message":"a message longer than the limit"}'`}, ExecOptions{})
+	assert.NoError(t, err)
+	s, output, _, err := NewExecProbe().ProbeJSON(cmd, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Equal(t, "JSON output exceeds 16 bytes", output)
+}
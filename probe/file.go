@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+)
+
+// maxFileContentBytes is how much of a file is matched against ContentRegex.
+const maxFileContentBytes = 1 << 20
+
+type FileExpectations struct {
+	// MaxAge of zero disables the modification time check
+	MaxAge  time.Duration
+	MinSize int64
+	// MaxSize of zero disables the upper size bound
+	MaxSize int64
+	// ContentRegex must match within the first MiB of the file
+	ContentRegex *regexp.Regexp
+}
+
+type FileProbe interface {
+	Probe(path string, expect FileExpectations) (status.Status, string, error)
+}
+
+type fileProbe struct{}
+
+func NewFileProbe() FileProbe {
+	return fileProbe{}
+}
+
+// Probe checks that path is a file whose modification time, size and content
+// meet expect. A missing file is a Failure.
+func (pr fileProbe) Probe(path string, expect FileExpectations) (status.Status, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return status.Failure, err.Error(), nil
+	}
+	if info.IsDir() {
+		return status.Failure, fmt.Sprintf("%s is a directory", path), nil
+	}
+	age := time.Since(info.ModTime())
+	output := fmt.Sprintf("%s: %d bytes, modified %v ago", path, info.Size(), age.Round(time.Second))
+	if expect.MaxAge > 0 && age > expect.MaxAge {
+		return status.Failure, fmt.Sprintf("older than %v, %s", expect.MaxAge, output), nil
+	}
+	if info.Size() < expect.MinSize {
+		return status.Failure, fmt.Sprintf("smaller than %d bytes, %s", expect.MinSize, output), nil
+	}
+	if expect.MaxSize > 0 && info.Size() > expect.MaxSize {
+		return status.Failure, fmt.Sprintf("larger than %d bytes, %s", expect.MaxSize, output), nil
+	}
+	if expect.ContentRegex != nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return status.Failure, err.Error(), nil
+		}
+		defer f.Close()
+		content, err := io.ReadAll(io.LimitReader(f, maxFileContentBytes))
+		if err != nil {
+			return status.Failure, err.Error(), nil
+		}
+		if !expect.ContentRegex.Match(content) {
+			return status.Failure, fmt.Sprintf("content does not match %q, %s", expect.ContentRegex, output), nil
+		}
+	}
+	return status.Success, output, nil
+}
@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileProbe(t *testing.T) {
+	dir := t.TempDir()
+	fresh := filepath.Join(dir, "heartbeat")
+	assert.NoError(t, os.WriteFile(fresh, []byte("state=running\n"), 0644))
+	stale := filepath.Join(dir, "stale")
+	assert.NoError(t, os.WriteFile(stale, []byte("state=running\n"), 0644))
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(stale, old, old))
+
+	tests := []struct {
+		name           string
+		path           string
+		expect         FileExpectations
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"exists", fresh, FileExpectations{}, status.Success, "14 bytes"},
+		{"missing", filepath.Join(dir, "missing"), FileExpectations{}, status.Failure, "no such file"},
+		{"directory", dir, FileExpectations{}, status.Failure, "is a directory"},
+		{"fresh", fresh, FileExpectations{MaxAge: time.Minute}, status.Success, ""},
+		{"stale", stale, FileExpectations{MaxAge: time.Minute}, status.Failure, "older than 1m0s"},
+		{"too small", fresh, FileExpectations{MinSize: 100}, status.Failure, "smaller than 100 bytes"},
+		{"too large", fresh, FileExpectations{MaxSize: 10}, status.Failure, "larger than 10 bytes"},
+		{"content", fresh, FileExpectations{ContentRegex: regexp.MustCompile(`(?m)^state=running$`)}, status.Success, ""},
+		{"content mismatch", fresh, FileExpectations{ContentRegex: regexp.MustCompile(`state=stopped`)}, status.Failure, "content does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := NewFileProbe().Probe(tt.path, tt.expect)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+type GrpcProbe interface {
+	Probe(addr string, service string, md map[string]string, tlsConfig *tls.Config, timeout time.Duration) (status.Status, string, error)
+}
+
+type grpcProbe struct{}
+
+func NewGrpcProbe() GrpcProbe {
+	return grpcProbe{}
+}
+
+// Probe calls grpc.health.v1.Health/Check on addr. A nil tlsConfig means the
+// connection is made in plaintext.
+func (pr grpcProbe) Probe(addr string, service string, md map[string]string, tlsConfig *tls.Config, timeout time.Duration) (status.Status, string, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUserAgent("sprobe"),
+	)
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if len(md) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(md))
+	}
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		switch grpcstatus.Code(err) {
+		case codes.Unimplemented:
+			return status.Failure, fmt.Sprintf("server does not implement the grpc health protocol: %v", err), nil
+		case codes.DeadlineExceeded:
+			return status.Failure, fmt.Sprintf("gRPC health check timed out after %v", timeout), nil
+		default:
+			return status.Failure, fmt.Sprintf("gRPC health check failed: %v", err), nil
+		}
+	}
+
+	switch res.GetStatus() {
+	case healthpb.HealthCheckResponse_SERVING:
+		return status.Success, res.GetStatus().String(), nil
+	case healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_SERVICE_UNKNOWN:
+		return status.Failure, fmt.Sprintf("gRPC health check returned status %s", res.GetStatus()), nil
+	default:
+		return status.Unknown, fmt.Sprintf("gRPC health check returned status %s", res.GetStatus()), nil
+	}
+}
@@ -0,0 +1,93 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+type metadataCheckingServer struct {
+	healthpb.UnimplementedHealthServer
+	key   string
+	value string
+}
+
+func (m *metadataCheckingServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get(m.key) {
+		if v == m.value {
+			return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+		}
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+}
+
+func startGrpcServer(t *testing.T, register func(*grpc.Server)) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func TestGrpcHealthChecker(t *testing.T) {
+	hs := health.NewServer()
+	hs.SetServingStatus("serving", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("not-serving", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus("unknown", healthpb.HealthCheckResponse_UNKNOWN)
+	addr := startGrpcServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, hs)
+	})
+	unimplementedAddr := startGrpcServer(t, func(s *grpc.Server) {})
+
+	tests := []struct {
+		name           string
+		addr           string
+		service        string
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"overall", addr, "", status.Success, "SERVING"},
+		{"serving", addr, "serving", status.Success, "SERVING"},
+		{"not serving", addr, "not-serving", status.Failure, "NOT_SERVING"},
+		{"unknown", addr, "unknown", status.Unknown, "UNKNOWN"},
+		{"missing service", addr, "missing", status.Failure, "NotFound"},
+		{"unimplemented", unimplementedAddr, "", status.Failure, "does not implement"},
+		{"no server", "127.0.0.1:1", "", status.Failure, "failed"},
+	}
+
+	prober := NewGrpcProbe()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := prober.Probe(tt.addr, tt.service, nil, nil, 1*time.Second)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
+
+func TestGrpcHealthCheckerMetadata(t *testing.T) {
+	addr := startGrpcServer(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, &metadataCheckingServer{key: "authorization", value: "token"})
+	})
+
+	prober := NewGrpcProbe()
+	s, _, err := prober.Probe(addr, "", map[string]string{"authorization": "token"}, nil, 1*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Success, s)
+
+	s, _, err = prober.Probe(addr, "", nil, nil, 1*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+}
@@ -1,10 +1,12 @@
 package probe
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 
 type HttpProbe interface {
 	Probe(req *http.Request, timeout time.Duration) (status.Status, string, error)
+	ProbeWithExpectations(req *http.Request, timeout time.Duration, expect *HTTPExpectations) (status.Status, string, error)
 }
 
 type httpProbe struct {
@@ -32,18 +35,44 @@ func NewWithTLSConfig(config *tls.Config, followNonLocalRedirects bool) *httpPro
 			TLSClientConfig:    config,
 			DisableKeepAlives:  true,
 			DisableCompression: true,
+			DialContext:        dialContext(&net.Dialer{}),
 		}
 
 	return &httpProbe{transport, followNonLocalRedirects}
 }
 
+type socketPathKey struct{}
+
+// WithSocketPath returns a copy of req that is sent over the Unix domain
+// socket at path. The URL is still used for the request line and Host header,
+// and redirects followed by the probe are sent over the same socket.
+func WithSocketPath(req *http.Request, path string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), socketPathKey{}, path))
+}
+
+func dialContext(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if path, ok := ctx.Value(socketPathKey{}).(string); ok && path != "" {
+			return d.DialContext(ctx, "unix", path)
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
 func (pr *httpProbe) Probe(req *http.Request, timeout time.Duration) (status.Status, string, error) {
-	client := &http.Client{
+	return DoHTTPProbe(req, pr.client(timeout))
+}
+
+func (pr *httpProbe) ProbeWithExpectations(req *http.Request, timeout time.Duration, expect *HTTPExpectations) (status.Status, string, error) {
+	return DoHTTPProbeWithExpectations(req, pr.client(timeout), expect)
+}
+
+func (pr *httpProbe) client(timeout time.Duration) *http.Client {
+	return &http.Client{
 		Timeout:       timeout,
 		Transport:     pr.transport,
 		CheckRedirect: RedirectChecker(pr.followNonLocalRedirects),
 	}
-	return DoHTTPProbe(req, client)
 }
 
 type GetHTTPInterface interface {
@@ -60,16 +89,22 @@ func DoHTTPProbe(req *http.Request, client GetHTTPInterface) (status.Status, str
 	if err != nil {
 		return status.Failure, "", err
 	}
-	body := string(b)
-	if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusBadRequest {
-		if res.StatusCode >= http.StatusMultipleChoices {
-			return status.Warning, fmt.Sprintf("Probe terminated redirects, Response body: %v", body), nil
+	result, output := classifyStatusCode(res.StatusCode, string(b))
+	return result, output, nil
+}
+
+// classifyStatusCode accepts 2xx and reports 3xx, left when redirects are
+// not followed, as a warning.
+func classifyStatusCode(code int, body string) (status.Status, string) {
+	if code >= http.StatusOK && code < http.StatusBadRequest {
+		if code >= http.StatusMultipleChoices {
+			return status.Warning, fmt.Sprintf("Probe terminated redirects, Response body: %v", body)
 		}
-		return status.Success, body, nil
+		return status.Success, body
 	}
 
-	failureMsg := fmt.Sprintf("HTTP probe failed with statuscode: %d", res.StatusCode)
-	return status.Failure, failureMsg, nil
+	failureMsg := fmt.Sprintf("HTTP probe failed with statuscode: %d", code)
+	return status.Failure, failureMsg
 }
 
 func RedirectChecker(followNonLocalRedirects bool) func(*http.Request, []*http.Request) error {
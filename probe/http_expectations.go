@@ -0,0 +1,187 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/glendsoza/sprobe/status"
+)
+
+// StatusCodeRange is an inclusive range of accepted HTTP status codes.
+type StatusCodeRange struct {
+	Min int
+	Max int
+}
+
+func (r StatusCodeRange) Contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+type JSONPathAssertion struct {
+	Path  string
+	Value string
+}
+
+// HeaderAssertion requires a response header to be present. When Value is
+// non-empty the header must also equal it.
+type HeaderAssertion struct {
+	Name  string
+	Value string
+}
+
+// HTTPExpectations describes what a response must look like for the probe to
+// succeed. A nil or empty StatusCodes keeps the default 2xx/3xx handling of
+// DoHTTPProbe.
+type HTTPExpectations struct {
+	StatusCodes  []StatusCodeRange
+	BodyContains []string
+	BodyMatches  []*regexp.Regexp
+	JSONPaths    []JSONPathAssertion
+	Headers      []HeaderAssertion
+}
+
+func DoHTTPProbeWithExpectations(req *http.Request, client GetHTTPInterface, expect *HTTPExpectations) (status.Status, string, error) {
+	if expect == nil {
+		return DoHTTPProbe(req, client)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return status.Failure, err.Error(), nil
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return status.Failure, "", err
+	}
+	body := string(b)
+
+	result, output := status.Success, body
+	if len(expect.StatusCodes) == 0 {
+		result, output = classifyStatusCode(res.StatusCode, body)
+		if result == status.Failure {
+			return result, output, nil
+		}
+	} else if !statusCodeAccepted(expect.StatusCodes, res.StatusCode) {
+		return status.Failure, fmt.Sprintf("HTTP probe failed with unexpected statuscode: %d", res.StatusCode), nil
+	}
+
+	for _, h := range expect.Headers {
+		values, ok := res.Header[http.CanonicalHeaderKey(h.Name)]
+		if !ok {
+			return status.Failure, fmt.Sprintf("response header %s missing", h.Name), nil
+		}
+		if h.Value != "" && !contains(values, h.Value) {
+			return status.Failure, fmt.Sprintf("response header %s is %q, expected %q", h.Name, strings.Join(values, ", "), h.Value), nil
+		}
+	}
+	for _, sub := range expect.BodyContains {
+		if !strings.Contains(body, sub) {
+			return status.Failure, fmt.Sprintf("response body does not contain %q, Response body: %v", sub, body), nil
+		}
+	}
+	for _, re := range expect.BodyMatches {
+		if !re.MatchString(body) {
+			return status.Failure, fmt.Sprintf("response body does not match %q, Response body: %v", re.String(), body), nil
+		}
+	}
+	if len(expect.JSONPaths) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return status.Failure, fmt.Sprintf("response body is not valid JSON: %v", err), nil
+		}
+		for _, a := range expect.JSONPaths {
+			v, err := EvalJSONPath(doc, a.Path)
+			if err != nil {
+				return status.Failure, err.Error(), nil
+			}
+			if got := jsonValueString(v); got != a.Value {
+				return status.Failure, fmt.Sprintf("%s is %q, expected %q", a.Path, got, a.Value), nil
+			}
+		}
+	}
+
+	return result, output, nil
+}
+
+func statusCodeAccepted(ranges []StatusCodeRange, code int) bool {
+	for _, r := range ranges {
+		if r.Contains(code) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// EvalJSONPath resolves a dotted path such as "$.checks[0].status" against a
+// decoded JSON document. Only child and index selectors are supported.
+func EvalJSONPath(doc interface{}, path string) (interface{}, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	cur := doc
+	for p != "" {
+		var key string
+		switch {
+		case strings.HasPrefix(p, "["):
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path %q", path)
+			}
+			idx, err := strconv.Atoi(p[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid index in json path %q", path)
+			}
+			arr, ok := cur.([]interface{})
+			if !ok || idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("json path %s not found", path)
+			}
+			cur = arr[idx]
+			p = strings.TrimPrefix(p[end+1:], ".")
+			continue
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			key = p[:end]
+			p = strings.TrimPrefix(p[end:], ".")
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("json path %s not found", path)
+		}
+		cur, ok = obj[key]
+		if !ok {
+			return nil, fmt.Errorf("json path %s not found", path)
+		}
+	}
+	return cur, nil
+}
+
+func jsonValueString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
@@ -0,0 +1,194 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"status": "ok",
+		"checks": []interface{}{
+			map[string]interface{}{"name": "db", "up": true},
+		},
+	}
+	tests := []struct {
+		path     string
+		expected interface{}
+		hasError bool
+	}{
+		{"$.status", "ok", false},
+		{"status", "ok", false},
+		{"$.checks[0].name", "db", false},
+		{"$.checks[0].up", true, false},
+		{"$.checks[1].name", nil, true},
+		{"$.missing", nil, true},
+		{"$.status.nested", nil, true},
+	}
+	for _, tt := range tests {
+		v, err := EvalJSONPath(doc, tt.path)
+		if tt.hasError {
+			assert.Error(t, err, tt.path)
+			continue
+		}
+		assert.NoError(t, err, tt.path)
+		assert.Equal(t, tt.expected, v)
+	}
+}
+
+func TestHTTPProbeExpectations(t *testing.T) {
+	handleReq := func(s int, body string, headers map[string]string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(s)
+			w.Write([]byte(body))
+		}
+	}
+	echoMethodHandler := func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 64)
+		n, _ := r.Body.Read(buf)
+		fmt.Fprintf(w, "%s %s", r.Method, buf[:n])
+	}
+
+	testCases := []struct {
+		name    string
+		handler func(w http.ResponseWriter, r *http.Request)
+		method  string
+		body    string
+		expect  *HTTPExpectations
+		health  status.Status
+		output  string
+	}{
+		{
+			name:    "default codes",
+			handler: handleReq(http.StatusOK, "ok body", nil),
+			expect:  &HTTPExpectations{},
+			health:  status.Success,
+			output:  "ok body",
+		},
+		{
+			name:    "default codes failure",
+			handler: handleReq(http.StatusServiceUnavailable, "", nil),
+			expect:  &HTTPExpectations{},
+			health:  status.Failure,
+			output:  "statuscode: 503",
+		},
+		{
+			name:    "accepted code outside 2xx",
+			handler: handleReq(http.StatusServiceUnavailable, "draining", nil),
+			expect:  &HTTPExpectations{StatusCodes: []StatusCodeRange{{200, 299}, {503, 503}}},
+			health:  status.Success,
+			output:  "draining",
+		},
+		{
+			name:    "rejected code inside 2xx",
+			handler: handleReq(http.StatusNoContent, "", nil),
+			expect:  &HTTPExpectations{StatusCodes: []StatusCodeRange{{200, 200}}},
+			health:  status.Failure,
+			output:  "unexpected statuscode: 204",
+		},
+		{
+			name:    "method and body",
+			handler: echoMethodHandler,
+			method:  http.MethodPost,
+			body:    "payload",
+			expect:  &HTTPExpectations{BodyContains: []string{"POST payload"}},
+			health:  status.Success,
+			output:  "POST payload",
+		},
+		{
+			name:    "body substring missing",
+			handler: handleReq(http.StatusOK, "degraded", nil),
+			expect:  &HTTPExpectations{BodyContains: []string{"healthy"}},
+			health:  status.Failure,
+			output:  `does not contain "healthy"`,
+		},
+		{
+			name:    "body regex",
+			handler: handleReq(http.StatusOK, "uptime=123", nil),
+			expect:  &HTTPExpectations{BodyMatches: []*regexp.Regexp{regexp.MustCompile(`uptime=\d+`)}},
+			health:  status.Success,
+		},
+		{
+			name:    "body regex mismatch",
+			handler: handleReq(http.StatusOK, "uptime=", nil),
+			expect:  &HTTPExpectations{BodyMatches: []*regexp.Regexp{regexp.MustCompile(`uptime=\d+`)}},
+			health:  status.Failure,
+			output:  "does not match",
+		},
+		{
+			name:    "json path equal",
+			handler: handleReq(http.StatusOK, `{"status":"ok","replicas":3}`, nil),
+			expect:  &HTTPExpectations{JSONPaths: []JSONPathAssertion{{"$.status", "ok"}, {"$.replicas", "3"}}},
+			health:  status.Success,
+		},
+		{
+			name:    "json path degraded",
+			handler: handleReq(http.StatusOK, `{"status":"degraded"}`, nil),
+			expect:  &HTTPExpectations{JSONPaths: []JSONPathAssertion{{"$.status", "ok"}}},
+			health:  status.Failure,
+			output:  `$.status is "degraded", expected "ok"`,
+		},
+		{
+			name:    "json path invalid body",
+			handler: handleReq(http.StatusOK, `not json`, nil),
+			expect:  &HTTPExpectations{JSONPaths: []JSONPathAssertion{{"$.status", "ok"}}},
+			health:  status.Failure,
+			output:  "not valid JSON",
+		},
+		{
+			name:    "header present",
+			handler: handleReq(http.StatusOK, "", map[string]string{"X-Ready": "yes"}),
+			expect:  &HTTPExpectations{Headers: []HeaderAssertion{{Name: "x-ready"}}},
+			health:  status.Success,
+		},
+		{
+			name:    "header value mismatch",
+			handler: handleReq(http.StatusOK, "", map[string]string{"X-Ready": "no"}),
+			expect:  &HTTPExpectations{Headers: []HeaderAssertion{{Name: "X-Ready", Value: "yes"}}},
+			health:  status.Failure,
+			output:  `X-Ready is "no"`,
+		},
+		{
+			name:    "header missing",
+			handler: handleReq(http.StatusOK, "", nil),
+			expect:  &HTTPExpectations{Headers: []HeaderAssertion{{Name: "X-Ready"}}},
+			health:  status.Failure,
+			output:  "missing",
+		},
+	}
+
+	prober := NewHttpProbe(true)
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(test.handler))
+			defer server.Close()
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			var req *http.Request
+			var err error
+			if test.body != "" {
+				req, err = http.NewRequest(method, server.URL, strings.NewReader(test.body))
+			} else {
+				req, err = http.NewRequest(method, server.URL, nil)
+			}
+			assert.NoError(t, err)
+			health, output, err := prober.ProbeWithExpectations(req, 1*time.Second, test.expect)
+			assert.NoError(t, err)
+			assert.Equal(t, test.health, health)
+			assert.Contains(t, output, test.output)
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"github.com/glendsoza/sprobe/status"
 	"strconv"
 	"testing"
@@ -275,3 +276,49 @@ func TestHTTPProbeChecker(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPProbeUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "http.sock")
+	lis, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			fmt.Fprintf(w, "ok %s %s", r.Host, r.Header.Get("X-Probe"))
+		case "/redirect":
+			http.Redirect(w, r, "/healthz", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	server.Listener.Close()
+	server.Listener = lis
+	server.Start()
+	defer server.Close()
+
+	prober := NewHttpProbe(true)
+	testCases := []struct {
+		url    string
+		health status.Status
+		body   string
+	}{
+		{"http://docker/healthz", status.Success, "ok docker yes"},
+		{"http://docker/redirect", status.Success, "ok docker yes"},
+		{"http://docker/unready", status.Failure, "statuscode: 503"},
+	}
+	for _, test := range testCases {
+		req, err := http.NewRequest("GET", test.url, nil)
+		assert.NoError(t, err)
+		req.Header.Set("X-Probe", "yes")
+		health, output, err := prober.Probe(WithSocketPath(req, socketPath), 1*time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, test.health, health)
+		assert.Contains(t, output, test.body)
+	}
+
+	req, err := http.NewRequest("GET", "http://docker/healthz", nil)
+	assert.NoError(t, err)
+	health, _, err := prober.Probe(WithSocketPath(req, filepath.Join(t.TempDir(), "missing.sock")), 1*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, health)
+}
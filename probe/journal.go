@@ -0,0 +1,240 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+)
+
+type JournalEntry struct {
+	Time    time.Time
+	Message string
+}
+
+// JournalFollower streams new journal entries of a unit. The returned channel
+// is closed when following stops, either because ctx is done or the
+// underlying reader failed; the returned wait function then reports why.
+type JournalFollower interface {
+	Follow(ctx context.Context, unitName string) (<-chan JournalEntry, func() error, error)
+}
+
+type journalctlFollower struct{}
+
+// NewJournalctlFollower follows the journal through "journalctl --follow -o
+// json", which needs neither cgo nor libsystemd at build time.
+func NewJournalctlFollower() JournalFollower {
+	return journalctlFollower{}
+}
+
+func (journalctlFollower) Follow(ctx context.Context, unitName string) (<-chan JournalEntry, func() error, error) {
+	cmd := exec.CommandContext(ctx, "journalctl", "--follow", "--lines=0", "--output=json", "--unit", unitName)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	entries := make(chan JournalEntry, 64)
+	var waitErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(entries)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			entry, ok := parseJournalJSON(scanner.Bytes())
+			if !ok {
+				continue
+			}
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+			}
+		}
+		waitErr = cmd.Wait()
+		if waitErr == nil {
+			waitErr = fmt.Errorf("journalctl exited")
+		}
+	}()
+	return entries, func() error {
+		<-done
+		return waitErr
+	}, nil
+}
+
+func parseJournalJSON(line []byte) (JournalEntry, bool) {
+	var fields struct {
+		Message   json.RawMessage `json:"MESSAGE"`
+		Timestamp string          `json:"__REALTIME_TIMESTAMP"`
+	}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return JournalEntry{}, false
+	}
+	var entry JournalEntry
+	// binary or non UTF-8 messages are exported as an array of bytes
+	if err := json.Unmarshal(fields.Message, &entry.Message); err != nil {
+		var raw []byte
+		var ints []int
+		if json.Unmarshal(fields.Message, &ints) != nil {
+			return JournalEntry{}, false
+		}
+		for _, i := range ints {
+			raw = append(raw, byte(i))
+		}
+		entry.Message = string(raw)
+	}
+	if usec, err := strconv.ParseInt(fields.Timestamp, 10, 64); err == nil {
+		entry.Time = time.UnixMicro(usec)
+	}
+	return entry, true
+}
+
+type JournalProbe interface {
+	Probe(unitName string, patterns []*regexp.Regexp, maxMatches int, window time.Duration) (status.Status, string, error)
+	// Stop stops following the journal of unitName for all its probes
+	Stop(unitName string)
+}
+
+type journalMatch struct {
+	at      time.Time
+	pattern string
+	message string
+}
+
+type journalTail struct {
+	mutex   sync.Mutex
+	matches []journalMatch
+	running bool
+	err     error
+	cancel  context.CancelFunc
+}
+
+// journalTailKey identifies a tail, so that probes of the same unit with
+// other patterns or another window count their own matches.
+type journalTailKey struct {
+	unitName string
+	patterns string
+	window   time.Duration
+}
+
+func newJournalTailKey(unitName string, patterns []*regexp.Regexp, window time.Duration) journalTailKey {
+	exprs := make([]string, len(patterns))
+	for i, re := range patterns {
+		exprs[i] = re.String()
+	}
+	return journalTailKey{unitName: unitName, patterns: strings.Join(exprs, "\x00"), window: window}
+}
+
+type journalProbe struct {
+	follower JournalFollower
+	now      func() time.Time
+
+	mutex sync.Mutex
+	tails map[journalTailKey]*journalTail
+}
+
+func NewJournalProbe(follower JournalFollower) JournalProbe {
+	return &journalProbe{
+		follower: follower,
+		now:      time.Now,
+		tails:    map[journalTailKey]*journalTail{},
+	}
+}
+
+// Probe fails once the unit logged lines matching any of patterns more than
+// maxMatches times within window. The journal is followed in the background
+// from the first probe on, so only entries written after it are counted.
+func (pr *journalProbe) Probe(unitName string, patterns []*regexp.Regexp, maxMatches int, window time.Duration) (status.Status, string, error) {
+	key := newJournalTailKey(unitName, patterns, window)
+	tail, err := pr.tail(key, patterns)
+	if err != nil {
+		return status.Unknown, "", err
+	}
+
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+	if !tail.running {
+		err := tail.err
+		// started again on the next probe
+		pr.mutex.Lock()
+		if pr.tails[key] == tail {
+			delete(pr.tails, key)
+		}
+		pr.mutex.Unlock()
+		return status.Unknown, "", fmt.Errorf("stopped following the journal of %s: %w", unitName, err)
+	}
+	cutoff := pr.now().Add(-window)
+	kept := tail.matches[:0]
+	for _, m := range tail.matches {
+		if m.at.After(cutoff) {
+			kept = append(kept, m)
+		}
+	}
+	tail.matches = kept
+
+	if len(kept) > maxMatches {
+		last := kept[len(kept)-1]
+		return status.Failure, fmt.Sprintf("%d journal entries matched within %v, last matched %q: %s", len(kept), window, last.pattern, last.message), nil
+	}
+	return status.Success, fmt.Sprintf("%d journal entries matched within %v", len(kept), window), nil
+}
+
+func (pr *journalProbe) tail(key journalTailKey, patterns []*regexp.Regexp) (*journalTail, error) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	if tail, ok := pr.tails[key]; ok {
+		return tail, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, wait, err := pr.follower.Follow(ctx, key.unitName)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	tail := &journalTail{running: true, cancel: cancel}
+	pr.tails[key] = tail
+	go func() {
+		for entry := range entries {
+			at := entry.Time
+			if at.IsZero() {
+				at = pr.now()
+			}
+			for _, re := range patterns {
+				if re.MatchString(entry.Message) {
+					tail.mutex.Lock()
+					tail.matches = append(tail.matches, journalMatch{at: at, pattern: re.String(), message: entry.Message})
+					tail.mutex.Unlock()
+					break
+				}
+			}
+		}
+		err := wait()
+		tail.mutex.Lock()
+		tail.running = false
+		tail.err = err
+		tail.mutex.Unlock()
+	}()
+	return tail, nil
+}
+
+func (pr *journalProbe) Stop(unitName string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	for key, tail := range pr.tails {
+		if key.unitName == unitName {
+			tail.cancel()
+			delete(pr.tails, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+type FakeJournal struct {
+	entries chan JournalEntry
+	err     error
+	follows int
+	ctxs    []context.Context
+}
+
+func (f *FakeJournal) Follow(ctx context.Context, unitName string) (<-chan JournalEntry, func() error, error) {
+	f.follows++
+	f.ctxs = append(f.ctxs, ctx)
+	return f.entries, func() error { return f.err }, nil
+}
+
+func TestJournalProbe(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	journal := &FakeJournal{entries: make(chan JournalEntry)}
+	prober := NewJournalProbe(journal).(*journalProbe)
+	prober.now = func() time.Time { return now }
+	patterns := []*regexp.Regexp{regexp.MustCompile("panic:"), regexp.MustCompile("(?i)out of memory")}
+
+	s, output, err := prober.Probe("test.service", patterns, 1, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Success, s)
+	assert.Equal(t, "0 journal entries matched within 1m0s", output)
+
+	journal.entries <- JournalEntry{Time: now.Add(-2 * time.Minute), Message: "panic: too old"}
+	journal.entries <- JournalEntry{Time: now.Add(-30 * time.Second), Message: "Out Of Memory"}
+	journal.entries <- JournalEntry{Time: now.Add(-20 * time.Second), Message: "listening on :8080"}
+	journal.entries <- JournalEntry{Time: now.Add(-10 * time.Second), Message: "panic: nil map"}
+	// an unbuffered send only returns once the previous entry was handled
+	journal.entries <- JournalEntry{Time: now.Add(-5 * time.Second), Message: "done"}
+
+	s, output, err = prober.Probe("test.service", patterns, 1, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Equal(t, `2 journal entries matched within 1m0s, last matched "panic:": panic: nil map`, output)
+
+	s, _, err = prober.Probe("test.service", patterns, 2, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Success, s)
+	assert.Equal(t, 1, journal.follows)
+}
+
+func TestJournalProbeFollowerStopped(t *testing.T) {
+	journal := &FakeJournal{entries: make(chan JournalEntry), err: errors.New("journalctl exited")}
+	prober := NewJournalProbe(journal)
+	patterns := []*regexp.Regexp{regexp.MustCompile("panic:")}
+
+	_, _, err := prober.Probe("test.service", patterns, 0, time.Minute)
+	assert.NoError(t, err)
+	close(journal.entries)
+	assert.Eventually(t, func() bool {
+		s, _, err := prober.Probe("test.service", patterns, 0, time.Minute)
+		return s == status.Unknown && err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// the journal is followed again on the next probe
+	journal.entries = make(chan JournalEntry)
+	s, _, err := prober.Probe("test.service", patterns, 0, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Success, s)
+	assert.Equal(t, 2, journal.follows)
+}
+
+func TestJournalProbeTails(t *testing.T) {
+	journal := &FakeJournal{entries: make(chan JournalEntry)}
+	prober := NewJournalProbe(journal)
+	panics := []*regexp.Regexp{regexp.MustCompile("panic:")}
+	timeouts := []*regexp.Regexp{regexp.MustCompile("timeout")}
+
+	for _, probe := range []struct {
+		unitName string
+		patterns []*regexp.Regexp
+		window   time.Duration
+	}{
+		{"test.service", panics, time.Minute},
+		{"test.service", panics, time.Minute},
+		{"test.service", timeouts, time.Minute},
+		{"test.service", panics, time.Hour},
+		{"other.service", panics, time.Minute},
+	} {
+		_, _, err := prober.Probe(probe.unitName, probe.patterns, 0, probe.window)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 4, journal.follows, "probes with other patterns or windows follow on their own")
+
+	prober.Stop("test.service")
+	for _, ctx := range journal.ctxs[:3] {
+		assert.Error(t, ctx.Err(), "following is cancelled")
+	}
+	assert.NoError(t, journal.ctxs[3].Err(), "other units keep being followed")
+
+	_, _, err := prober.Probe("test.service", panics, 0, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, journal.follows)
+}
+
+func TestParseJournalJSON(t *testing.T) {
+	entry, ok := parseJournalJSON([]byte(`{"MESSAGE":"panic: nil map","__REALTIME_TIMESTAMP":"1704110400000000"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "panic: nil map", entry.Message)
+	assert.True(t, entry.Time.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	entry, ok = parseJournalJSON([]byte(`{"MESSAGE":[104,105,255]}`))
+	assert.True(t, ok)
+	assert.Equal(t, "hi\xff", entry.Message)
+	assert.True(t, entry.Time.IsZero())
+
+	_, ok = parseJournalJSON([]byte(`not json`))
+	assert.False(t, ok)
+}
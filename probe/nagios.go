@@ -0,0 +1,116 @@
+package probe
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PerfData is a single performance data value printed by a Nagios plugin.
+// Values are converted to seconds and bytes so that plugins reporting in
+// different units can be compared.
+type PerfData struct {
+	Label string
+	Value float64
+	// UOM is "s", "B", "%", "c" or empty
+	UOM string
+}
+
+var nagiosUnits = map[string]struct {
+	uom    string
+	factor float64
+}{
+	"":   {"", 1},
+	"s":  {"s", 1},
+	"ms": {"s", 1e-3},
+	"us": {"s", 1e-6},
+	"%":  {"%", 1},
+	"B":  {"B", 1},
+	"KB": {"B", 1 << 10},
+	"MB": {"B", 1 << 20},
+	"GB": {"B", 1 << 30},
+	"TB": {"B", 1 << 40},
+	"c":  {"c", 1},
+}
+
+// ParseNagiosOutput splits plugin output into its text and performance data.
+// The first line holds the summary and optionally "|" followed by performance
+// data; further lines are long text until a line containing "|", after which
+// everything is performance data.
+func ParseNagiosOutput(output string) (string, []PerfData) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	text, perf, _ := strings.Cut(lines[0], "|")
+	texts := []string{strings.TrimSpace(text)}
+	perfs := []string{perf}
+	for i := 1; i < len(lines); i++ {
+		longText, morePerf, found := strings.Cut(lines[i], "|")
+		texts = append(texts, longText)
+		if found {
+			perfs = append(perfs, morePerf)
+			perfs = append(perfs, lines[i+1:]...)
+			break
+		}
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n")), parsePerfData(strings.Join(perfs, " "))
+}
+
+// parsePerfData parses space separated 'label'=value[UOM];[warn];[crit];[min];[max]
+// entries. Malformed entries and undetermined values ("U") are skipped.
+func parsePerfData(s string) []PerfData {
+	var perfData []PerfData
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return perfData
+		}
+		var label string
+		if s[0] == '\'' {
+			// quotes within a quoted label are doubled
+			var b strings.Builder
+			i := 1
+			for ; i < len(s); i++ {
+				if s[i] == '\'' {
+					if i+1 < len(s) && s[i+1] == '\'' {
+						b.WriteByte('\'')
+						i++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[i])
+			}
+			label, s = b.String(), s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexAny(s, "= \t")
+			if end < 0 {
+				return perfData
+			}
+			label, s = s[:end], s[end:]
+		}
+		var value string
+		if rest, ok := strings.CutPrefix(s, "="); ok {
+			value, s, _ = strings.Cut(rest, " ")
+		} else {
+			// skip the malformed entry
+			_, s, _ = strings.Cut(s, " ")
+			continue
+		}
+		value, _, _ = strings.Cut(value, ";")
+		if pd, ok := parsePerfValue(label, value); ok {
+			perfData = append(perfData, pd)
+		}
+	}
+}
+
+func parsePerfValue(label string, value string) (PerfData, bool) {
+	end := strings.LastIndexAny(value, "0123456789.") + 1
+	number, unit := value[:end], value[end:]
+	v, err := strconv.ParseFloat(number, 64)
+	if label == "" || err != nil {
+		return PerfData{}, false
+	}
+	u, ok := nagiosUnits[unit]
+	if !ok {
+		return PerfData{}, false
+	}
+	return PerfData{Label: label, Value: v * u.factor, UOM: u.uom}, true
+}
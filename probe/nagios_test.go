@@ -0,0 +1,44 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNagiosOutput(t *testing.T) {
+	tests := []struct {
+		name             string
+		output           string
+		expectedText     string
+		expectedPerfData []PerfData
+	}{
+		{"text only", "OK - all good\n", "OK - all good", nil},
+		{
+			"single line",
+			"DISK OK - free space: / 3326 MB (56%);| /=2643MB;5948;5958;0;5968",
+			"DISK OK - free space: / 3326 MB (56%);",
+			[]PerfData{{Label: "/", Value: 2643 << 20, UOM: "B"}},
+		},
+		{
+			"quoted labels and units",
+			"OK | 'time taken'=250ms;1;2 'it''s'=5% count=3c undetermined=U bad",
+			"OK",
+			[]PerfData{{Label: "time taken", Value: 0.25, UOM: "s"}, {Label: "it's", Value: 5, UOM: "%"}, {Label: "count", Value: 3, UOM: "c"}},
+		},
+		{
+			"long text",
+			"WARNING - 2 queues backed up | total=12\nqueue a: 7\nqueue b: 5 | a=7\nb=5",
+			"WARNING - 2 queues backed up\nqueue a: 7\nqueue b: 5",
+			[]PerfData{{Label: "total", Value: 12}, {Label: "a", Value: 7}, {Label: "b", Value: 5}},
+		},
+		{"unknown unit", "OK | load=1.5xx temp=-3.5", "OK", []PerfData{{Label: "temp", Value: -3.5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, perfData := ParseNagiosOutput(tt.output)
+			assert.Equal(t, tt.expectedText, text)
+			assert.Equal(t, tt.expectedPerfData, perfData)
+		})
+	}
+}
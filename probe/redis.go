@@ -0,0 +1,115 @@
+package probe
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+)
+
+// RedisProbe checks a Redis server on network "tcp" or "unix".
+type RedisProbe interface {
+	Probe(network string, addr string, username string, password string, expectedRole string, timeout time.Duration) (status.Status, string, error)
+}
+
+type redisProbe struct{}
+
+func NewRedisProbe() RedisProbe {
+	return redisProbe{}
+}
+
+// Probe authenticates when password is set, sends PING and, when expectedRole
+// is set, fails unless INFO replication reports that role. Error replies such
+// as LOADING or NOAUTH are a Failure with the reply as output.
+func (pr redisProbe) Probe(network string, addr string, username string, password string, expectedRole string, timeout time.Duration) (status.Status, string, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return status.Failure, err.Error(), nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(conn)
+
+	if password != "" {
+		args := []string{"AUTH", password}
+		if username != "" {
+			args = []string{"AUTH", username, password}
+		}
+		if _, err := redisCommand(conn, r, args...); err != nil {
+			return status.Failure, fmt.Sprintf("AUTH: %v", err), nil
+		}
+	}
+	reply, err := redisCommand(conn, r, "PING")
+	if err != nil {
+		return status.Failure, fmt.Sprintf("PING: %v", err), nil
+	}
+	if expectedRole == "" {
+		return status.Success, reply, nil
+	}
+
+	info, err := redisCommand(conn, r, "INFO", "replication")
+	if err != nil {
+		return status.Failure, fmt.Sprintf("INFO: %v", err), nil
+	}
+	role := redisInfoField(info, "role")
+	output := fmt.Sprintf("%s role=%s", reply, role)
+	// replicas report "slave", accept the newer name too
+	if role != expectedRole && !(expectedRole == "replica" && role == "slave") {
+		return status.Failure, fmt.Sprintf("expected role %s, %s", expectedRole, output), nil
+	}
+	return status.Success, output, nil
+}
+
+// redisCommand sends args as a RESP array and returns a simple string or
+// bulk string reply. An error reply is returned as an error.
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return "", err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", errors.New(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("unexpected reply %q", line)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+func redisInfoField(info string, name string) string {
+	for _, line := range strings.Split(info, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), name+":"); ok {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package probe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+// startRedisServer serves a minimal subset of RESP: AUTH accepting password,
+// PING and INFO replication reporting role.
+func startRedisServer(t *testing.T, password string, role string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveRedis(conn, password, role)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveRedis(conn net.Conn, password string, role string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := password == ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ := r.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, size+2)
+			io.ReadFull(r, buf)
+			args[i] = string(buf[:size])
+		}
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] != password {
+				io.WriteString(conn, "-WRONGPASS invalid username-password pair\r\n")
+				continue
+			}
+			authenticated = true
+			io.WriteString(conn, "+OK\r\n")
+		case !authenticated:
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "PING":
+			io.WriteString(conn, "+PONG\r\n")
+		case args[0] == "INFO":
+			info := fmt.Sprintf("# Replication\r\nrole:%s\r\nconnected_slaves:0\r\n", role)
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(info), info)
+		}
+	}
+}
+
+func TestRedisProbe(t *testing.T) {
+	replica := startRedisServer(t, "", "slave")
+	secured := startRedisServer(t, "s3cret", "master")
+	tests := []struct {
+		name           string
+		addr           string
+		password       string
+		expectedRole   string
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"ping", replica, "", "", status.Success, "PONG"},
+		{"replica role", replica, "", "replica", status.Success, "PONG role=slave"},
+		{"wrong role", replica, "", "master", status.Failure, "expected role master, PONG role=slave"},
+		{"auth", secured, "s3cret", "master", status.Success, "PONG role=master"},
+		{"no auth", secured, "", "", status.Failure, "PING: NOAUTH Authentication required."},
+		{"wrong password", secured, "guess", "", status.Failure, "AUTH: WRONGPASS invalid username-password pair"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := NewRedisProbe().Probe("tcp", tt.addr, "", tt.password, tt.expectedRole, time.Second)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Equal(t, tt.expectedOutput, output)
+		})
+	}
+}
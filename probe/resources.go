@@ -0,0 +1,223 @@
+package probe
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+)
+
+// clockTicks is USER_HZ, which the kernel fixes at 100 on every architecture
+// systemd supports.
+const clockTicks = 100
+
+// Threshold holds the levels at which a resource turns the probe into a
+// Warning or a Failure. A nil level is not checked.
+type Threshold struct {
+	Warning *float64
+	Failure *float64
+}
+
+type ResourceLimits struct {
+	RSSBytes       Threshold
+	CPUPercent     Threshold
+	OpenFiles      Threshold
+	Threads        Threshold
+	MemoryPressure Threshold
+}
+
+type ResourcesProbe interface {
+	Probe(unitName string, probeName string, limits ResourceLimits) (status.Status, string, error)
+	// Stop forgets the CPU samples taken for the probes of unitName.
+	Stop(unitName string)
+}
+
+type cpuSample struct {
+	pid   uint32
+	ticks uint64
+	at    time.Time
+}
+
+type resourcesProbe struct {
+	units      UnitStateReader
+	procRoot   string
+	cgroupRoot string
+	now        func() time.Time
+
+	mutex sync.Mutex
+	// cpuSamples are keyed by unit, then by probe
+	cpuSamples map[string]map[string]cpuSample
+}
+
+func NewResourcesProbe(units UnitStateReader) ResourcesProbe {
+	return &resourcesProbe{
+		units:      units,
+		procRoot:   "/proc",
+		cgroupRoot: "/sys/fs/cgroup",
+		now:        time.Now,
+		cpuSamples: map[string]map[string]cpuSample{},
+	}
+}
+
+// Probe resolves the unit's main process and cgroup and compares their
+// resource usage against limits. CPU usage is averaged since the previous
+// run of the probe named probeName, so it is only checked from its second run
+// on.
+func (pr *resourcesProbe) Probe(unitName string, probeName string, limits ResourceLimits) (status.Status, string, error) {
+	state, err := pr.units.State(unitName)
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	if state.MainPID == 0 {
+		return status.Failure, fmt.Sprintf("unit has no main process, ActiveState=%s", state.ActiveState), nil
+	}
+	procDir := filepath.Join(pr.procRoot, strconv.FormatUint(uint64(state.MainPID), 10))
+
+	result := status.Success
+	var usage, reasons []string
+	check := func(name string, value float64, t Threshold, format string) {
+		usage = append(usage, fmt.Sprintf("%s="+format, name, value))
+		switch {
+		case t.Failure != nil && value >= *t.Failure:
+			result = status.Failure
+			reasons = append(reasons, fmt.Sprintf("%s "+format+" exceeds failure threshold "+format, name, value, *t.Failure))
+		case t.Warning != nil && value >= *t.Warning:
+			if result != status.Failure {
+				result = status.Warning
+			}
+			reasons = append(reasons, fmt.Sprintf("%s "+format+" exceeds warning threshold "+format, name, value, *t.Warning))
+		}
+	}
+
+	procStatus, err := readKeyValues(filepath.Join(procDir, "status"), ":")
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	rssKB, _ := strconv.ParseFloat(strings.TrimSuffix(procStatus["VmRSS"], " kB"), 64)
+	check("rss_bytes", rssKB*1024, limits.RSSBytes, "%.0f")
+	threads, _ := strconv.ParseFloat(procStatus["Threads"], 64)
+	check("threads", threads, limits.Threads, "%.0f")
+
+	fds, err := os.ReadDir(filepath.Join(procDir, "fd"))
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	check("open_files", float64(len(fds)), limits.OpenFiles, "%.0f")
+
+	ticks, err := readCPUTicks(filepath.Join(procDir, "stat"))
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	if cpu, ok := pr.cpuPercent(unitName, probeName, state.MainPID, ticks); ok {
+		check("cpu_percent", cpu, limits.CPUPercent, "%.2f")
+	}
+
+	if limits.MemoryPressure.Warning != nil || limits.MemoryPressure.Failure != nil {
+		if state.ControlGroup == "" {
+			return status.Unknown, "", fmt.Errorf("unit %s has no control group", unitName)
+		}
+		pressure, err := readMemoryPressure(filepath.Join(pr.cgroupRoot, state.ControlGroup, "memory.pressure"))
+		if err != nil {
+			return status.Unknown, "", err
+		}
+		check("memory_pressure", pressure, limits.MemoryPressure, "%.2f")
+	}
+
+	output := strings.Join(usage, " ")
+	if len(reasons) > 0 {
+		output = strings.Join(reasons, ", ") + "; " + output
+	}
+	return result, output, nil
+}
+
+func (pr *resourcesProbe) Stop(unitName string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	delete(pr.cpuSamples, unitName)
+}
+
+func (pr *resourcesProbe) cpuPercent(unitName string, probeName string, pid uint32, ticks uint64) (float64, bool) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	now := pr.now()
+	samples, ok := pr.cpuSamples[unitName]
+	if !ok {
+		samples = map[string]cpuSample{}
+		pr.cpuSamples[unitName] = samples
+	}
+	prev, ok := samples[probeName]
+	samples[probeName] = cpuSample{pid: pid, ticks: ticks, at: now}
+	elapsed := now.Sub(prev.at).Seconds()
+	if !ok || prev.pid != pid || ticks < prev.ticks || elapsed <= 0 {
+		return 0, false
+	}
+	return float64(ticks-prev.ticks) / clockTicks / elapsed * 100, true
+}
+
+func readKeyValues(path string, sep string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), sep)
+		if ok {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return values, scanner.Err()
+}
+
+// readCPUTicks returns utime+stime from /proc/<pid>/stat. The command name
+// may contain spaces, so fields are counted from its closing parenthesis.
+func readCPUTicks(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	stat := string(b)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	// utime and stime are fields 14 and 15, the slice starts at field 3
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected format of %s", path)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return utime + stime, nil
+}
+
+// readMemoryPressure returns the "some avg10" value of a cgroup v2 PSI file,
+// the share of the last 10 seconds in which a task stalled on memory.
+func readMemoryPressure(path string) (float64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(f, "avg10="); ok {
+				return strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("no memory pressure found in %s", path)
+}
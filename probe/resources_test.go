@@ -0,0 +1,182 @@
+package probe
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/glendsoza/sprobe/sysd"
+	"github.com/stretchr/testify/assert"
+)
+
+func float64Ref(f float64) *float64 {
+	return &f
+}
+
+type fakeProcess struct {
+	rssKB    int
+	threads  int
+	fds      int
+	ticks    int
+	pressure string
+}
+
+func writeFakeProcess(t *testing.T, procRoot, cgroupRoot string, pid int, p fakeProcess) {
+	dir := filepath.Join(procRoot, fmt.Sprint(pid))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "fd"), 0o755))
+	status := fmt.Sprintf("Name:\ttest\nVmRSS:\t   %d kB\nThreads:\t%d\n", p.rssKB, p.threads)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0o644))
+	for i := 0; i < p.fds; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "fd", fmt.Sprint(i)), nil, 0o644))
+	}
+	stat := fmt.Sprintf("%d (my daemon) S 1 1 1 0 -1 4194560 100 0 0 0 %d 0 0 0 20 0 1 0 100 0 0\n", pid, p.ticks)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o644))
+	cgroup := filepath.Join(cgroupRoot, "system.slice", "test.service")
+	assert.NoError(t, os.MkdirAll(cgroup, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(cgroup, "memory.pressure"), []byte(p.pressure), 0o644))
+}
+
+func newTestResourcesProbe(t *testing.T, state *sysd.UnitState) (*resourcesProbe, string, string) {
+	procRoot := t.TempDir()
+	cgroupRoot := t.TempDir()
+	prober := NewResourcesProbe(&FakeUnits{state: state}).(*resourcesProbe)
+	prober.procRoot = procRoot
+	prober.cgroupRoot = cgroupRoot
+	return prober, procRoot, cgroupRoot
+}
+
+func TestResourcesProbeThresholds(t *testing.T) {
+	state := &sysd.UnitState{ActiveState: "active", MainPID: 42, ControlGroup: "/system.slice/test.service"}
+	process := fakeProcess{
+		rssKB:    2048,
+		threads:  12,
+		fds:      5,
+		pressure: "some avg10=3.50 avg60=1.00 avg300=0.20 total=100\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	}
+	tests := []struct {
+		name           string
+		limits         ResourceLimits
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{
+			name:           "within limits",
+			limits:         ResourceLimits{RSSBytes: Threshold{Warning: float64Ref(4 * 1024 * 1024)}},
+			expectedStatus: status.Success,
+			expectedOutput: "rss_bytes=2097152 threads=12 open_files=5",
+		},
+		{
+			name:           "rss warning",
+			limits:         ResourceLimits{RSSBytes: Threshold{Warning: float64Ref(1024 * 1024), Failure: float64Ref(4 * 1024 * 1024)}},
+			expectedStatus: status.Warning,
+			expectedOutput: "rss_bytes 2097152 exceeds warning threshold 1048576",
+		},
+		{
+			name:           "threads failure",
+			limits:         ResourceLimits{Threads: Threshold{Warning: float64Ref(5), Failure: float64Ref(10)}},
+			expectedStatus: status.Failure,
+			expectedOutput: "threads 12 exceeds failure threshold 10",
+		},
+		{
+			name: "failure wins over warning",
+			limits: ResourceLimits{
+				OpenFiles: Threshold{Warning: float64Ref(5)},
+				Threads:   Threshold{Failure: float64Ref(12)},
+			},
+			expectedStatus: status.Failure,
+			expectedOutput: "threads 12 exceeds failure threshold 12, open_files 5 exceeds warning threshold 5",
+		},
+		{
+			name:           "memory pressure",
+			limits:         ResourceLimits{MemoryPressure: Threshold{Warning: float64Ref(1), Failure: float64Ref(10)}},
+			expectedStatus: status.Warning,
+			expectedOutput: "memory_pressure 3.50 exceeds warning threshold 1.00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober, procRoot, cgroupRoot := newTestResourcesProbe(t, state)
+			writeFakeProcess(t, procRoot, cgroupRoot, 42, process)
+			s, output, err := prober.Probe("test.service", "liveness", tt.limits)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
+
+func TestResourcesProbeCPU(t *testing.T) {
+	state := &sysd.UnitState{ActiveState: "active", MainPID: 42}
+	prober, procRoot, cgroupRoot := newTestResourcesProbe(t, state)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prober.now = func() time.Time { return now }
+	limits := ResourceLimits{CPUPercent: Threshold{Warning: float64Ref(50), Failure: float64Ref(90)}}
+
+	writeFakeProcess(t, procRoot, cgroupRoot, 42, fakeProcess{ticks: 1000})
+	s, output, err := prober.Probe("test.service", "liveness", limits)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Success, s)
+	assert.NotContains(t, output, "cpu_percent")
+
+	// 700 ticks over 10 seconds is 70% of one core
+	now = now.Add(10 * time.Second)
+	writeFakeProcess(t, procRoot, cgroupRoot, 42, fakeProcess{ticks: 1700})
+	s, output, err = prober.Probe("test.service", "liveness", limits)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Warning, s)
+	assert.Contains(t, output, "cpu_percent 70.00 exceeds warning threshold 50.00")
+
+	// a new main process starts a new baseline
+	now = now.Add(10 * time.Second)
+	state.MainPID = 43
+	writeFakeProcess(t, procRoot, cgroupRoot, 43, fakeProcess{ticks: 5000})
+	s, output, err = prober.Probe("test.service", "liveness", limits)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Success, s)
+	assert.NotContains(t, output, "cpu_percent")
+}
+
+func TestResourcesProbeCPUPerProbe(t *testing.T) {
+	state := &sysd.UnitState{ActiveState: "active", MainPID: 42}
+	prober, procRoot, cgroupRoot := newTestResourcesProbe(t, state)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prober.now = func() time.Time { return now }
+	liveness := ResourceLimits{CPUPercent: Threshold{Failure: float64Ref(90)}}
+	readiness := ResourceLimits{CPUPercent: Threshold{Warning: float64Ref(50)}}
+
+	writeFakeProcess(t, procRoot, cgroupRoot, 42, fakeProcess{ticks: 1000})
+	_, _, err := prober.Probe("test.service", "liveness", liveness)
+	assert.NoError(t, err)
+	now = now.Add(time.Second)
+	_, output, err := prober.Probe("test.service", "readiness", readiness)
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "cpu_percent", "the first run of the readiness probe only takes a sample")
+
+	// 700 ticks over 10 seconds is 70% of one core, as the readiness probe
+	// is compared against its own previous sample
+	now = now.Add(10 * time.Second)
+	writeFakeProcess(t, procRoot, cgroupRoot, 42, fakeProcess{ticks: 1700})
+	s, output, err := prober.Probe("test.service", "readiness", readiness)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Warning, s)
+	assert.Contains(t, output, "cpu_percent 70.00")
+
+	prober.Stop("test.service")
+	assert.Empty(t, prober.cpuSamples, "stopping the unit forgets its samples")
+}
+
+func TestResourcesProbeNoProcess(t *testing.T) {
+	prober, _, _ := newTestResourcesProbe(t, &sysd.UnitState{ActiveState: "inactive"})
+	s, output, err := prober.Probe("test.service", "liveness", ResourceLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Contains(t, output, "no main process")
+
+	prober, _, _ = newTestResourcesProbe(t, &sysd.UnitState{ActiveState: "active", MainPID: 42})
+	s, _, err = prober.Probe("test.service", "liveness", ResourceLimits{})
+	assert.Error(t, err)
+	assert.Equal(t, status.Unknown, s)
+}
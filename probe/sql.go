@@ -0,0 +1,96 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+// SqlProbe checks a database through a database/sql driver, "postgres" or
+// "mysql".
+type SqlProbe interface {
+	Probe(driverName string, dsn string, query string, timeout time.Duration) (status.Status, string, error)
+}
+
+type sqlProbe struct{}
+
+func NewSqlProbe() SqlProbe {
+	return sqlProbe{}
+}
+
+// Probe opens a single connection, which runs the startup handshake and
+// authentication, and then runs query, or only pings the server when query
+// is empty. Connection and query errors are a Failure with the server's error
+// message as output.
+func (pr sqlProbe) Probe(driverName string, dsn string, query string, timeout time.Duration) (status.Status, string, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		return status.Failure, err.Error(), nil
+	}
+	if query == "" {
+		return status.Success, "ping succeeded", nil
+	}
+	var result string
+	if err := db.QueryRowContext(ctx, query).Scan(&result); err != nil {
+		return status.Failure, err.Error(), nil
+	}
+	return status.Success, fmt.Sprintf("%s returned %s", query, result), nil
+}
+
+// PostgresDSN returns a lib/pq connection string. A host starting with "/" is
+// the directory of the server's Unix socket, as with libpq.
+func PostgresDSN(host string, port int, user string, password string, database string, sslMode string, timeout time.Duration) string {
+	params := []struct{ key, value string }{
+		{"host", host},
+		{"port", strconv.Itoa(port)},
+		{"user", user},
+		{"password", password},
+		{"dbname", database},
+		{"sslmode", sslMode},
+		{"connect_timeout", strconv.Itoa(max(1, int(timeout.Seconds())))},
+	}
+	var parts []string
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		// values are single quoted with backslash escapes, see "Keyword/Value
+		// Connection Strings" in the libpq docs
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(p.value)
+		parts = append(parts, fmt.Sprintf("%s='%s'", p.key, value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// MySQLDSN returns a go-sql-driver DSN for a server on host:port, or on
+// socketPath when set.
+func MySQLDSN(host string, port int, socketPath string, user string, password string, database string, timeout time.Duration) string {
+	cfg := mysql.NewConfig()
+	cfg.User = user
+	cfg.Passwd = password
+	cfg.DBName = database
+	cfg.Timeout = timeout
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	if socketPath != "" {
+		cfg.Net = "unix"
+		cfg.Addr = socketPath
+	}
+	return cfg.FormatDSN()
+}
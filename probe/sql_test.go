@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	assert.Equal(t, `host='db.local' port='5432' user='app' password='it\'s \\ secret' dbname='app' sslmode='verify-full' connect_timeout='5'`,
+		PostgresDSN("db.local", 5432, "app", `it's \ secret`, "app", "verify-full", 5*time.Second))
+	assert.Equal(t, `host='/run/postgresql' port='5433' user='postgres' connect_timeout='1'`,
+		PostgresDSN("/run/postgresql", 5433, "postgres", "", "", "", 100*time.Millisecond))
+}
+
+func TestMySQLDSN(t *testing.T) {
+	assert.Equal(t, "app:secret@tcp(localhost:3306)/app?timeout=2s",
+		MySQLDSN("localhost", 3306, "", "app", "secret", "app", 2*time.Second))
+	assert.Equal(t, "root@unix(/run/mysqld/mysqld.sock)/?timeout=2s",
+		MySQLDSN("localhost", 3306, "/run/mysqld/mysqld.sock", "root", "", "", 2*time.Second))
+}
+
+func TestSQLProbeConnectionRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	s, output, err := NewSqlProbe().Probe("postgres", PostgresDSN("127.0.0.1", port, "postgres", "", "", "disable", time.Second), "SELECT 1", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Contains(t, output, "connection refused")
+
+	s, output, err = NewSqlProbe().Probe("mysql", MySQLDSN("127.0.0.1", port, "", "root", "", "", time.Second), "", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Contains(t, output, "connection refused")
+}
@@ -1,14 +1,38 @@
 package probe
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net"
-	"github.com/glendsoza/sprobe/status"
-	"strconv"
+	"os"
+	"regexp"
 	"time"
+
+	"github.com/glendsoza/sprobe/status"
 )
 
+// maxTCPReceiveBytes bounds what a step reads while waiting for its
+// expectation, so that a chatty peer cannot keep it reading until the
+// deadline.
+const maxTCPReceiveBytes = 64 * 1024
+
+// TCPStep is one exchange of a send/expect conversation. Send is written
+// first when set, then the connection is read until ExpectRegex matches or
+// the reply starts with Expect, bounded by Timeout. Expect is a prefix match:
+// whatever the peer sends after it is ignored. Timeout can only shorten a
+// step: the probe's timeout bounds the whole conversation.
+type TCPStep struct {
+	Send        []byte
+	Expect      []byte
+	ExpectRegex *regexp.Regexp
+	Timeout     time.Duration
+}
+
+// TcpProbe connects to addr on any stream oriented network accepted by
+// net.Dial, i.e. "tcp", "tcp4", "tcp6", "unix" or "unixpacket".
 type TcpProbe interface {
-	Probe(host string, port int, timeout time.Duration) (status.Status, string, error)
+	Probe(network string, addr string, steps []TCPStep, timeout time.Duration) (status.Status, string, error)
 }
 
 type tcpProbe struct{}
@@ -17,16 +41,76 @@ func NewTcpProbe() TcpProbe {
 	return tcpProbe{}
 }
 
-func (pr tcpProbe) Probe(host string, port int, timeout time.Duration) (status.Status, string, error) {
-	return DoTCPProbe(net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+func (pr tcpProbe) Probe(network string, addr string, steps []TCPStep, timeout time.Duration) (status.Status, string, error) {
+	return DoTCPProbe(network, addr, steps, timeout)
 }
 
-func DoTCPProbe(addr string, timeout time.Duration) (status.Status, string, error) {
-	d := net.Dialer{Timeout: timeout}
-	conn, err := d.Dial("tcp", addr)
+func DoTCPProbe(network string, addr string, steps []TCPStep, timeout time.Duration) (status.Status, string, error) {
+	deadline := time.Now().Add(timeout)
+	d := net.Dialer{Deadline: deadline}
+	conn, err := d.Dial(network, addr)
 	if err != nil {
 		return status.Failure, err.Error(), nil
 	}
-	conn.Close()
-	return status.Success, "", nil
+	defer conn.Close()
+	var received []byte
+	for i, step := range steps {
+		received, err = doTCPStep(conn, step, deadline)
+		if err != nil {
+			return status.Failure, fmt.Sprintf("step %d: %v", i+1, err), nil
+		}
+	}
+	return status.Success, string(received), nil
+}
+
+func doTCPStep(conn net.Conn, step TCPStep, deadline time.Time) ([]byte, error) {
+	if step.Timeout > 0 {
+		if stepDeadline := time.Now().Add(step.Timeout); stepDeadline.Before(deadline) {
+			deadline = stepDeadline
+		}
+	}
+	conn.SetDeadline(deadline)
+	if len(step.Send) > 0 {
+		if _, err := conn.Write(step.Send); err != nil {
+			return nil, err
+		}
+	}
+	if step.Expect == nil && step.ExpectRegex == nil {
+		return nil, nil
+	}
+
+	var received []byte
+	buf := make([]byte, 4096)
+	for {
+		if step.Expect != nil && len(received) >= len(step.Expect) {
+			if bytes.HasPrefix(received, step.Expect) {
+				return received, nil
+			}
+			return received, fmt.Errorf("expected %q, received %q", step.Expect, received)
+		}
+		if step.ExpectRegex != nil && step.ExpectRegex.Match(received) {
+			return received, nil
+		}
+		if len(received) >= maxTCPReceiveBytes {
+			return received[:maxTCPReceiveBytes], fmt.Errorf("expected %s within the first %d bytes received", describeExpectation(step), maxTCPReceiveBytes)
+		}
+		n, err := conn.Read(buf[:min(len(buf), maxTCPReceiveBytes-len(received))])
+		received = append(received, buf[:n]...)
+		if err != nil {
+			if n > 0 {
+				continue
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = errors.New("timed out")
+			}
+			return received, fmt.Errorf("expected %s, received %q: %v", describeExpectation(step), received, err)
+		}
+	}
+}
+
+func describeExpectation(step TCPStep) string {
+	if step.ExpectRegex != nil {
+		return fmt.Sprintf("match for %q", step.ExpectRegex.String())
+	}
+	return fmt.Sprintf("%q", step.Expect)
 }
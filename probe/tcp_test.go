@@ -17,11 +17,16 @@ limitations under the License.
 package probe
 
 import (
+	"bufio"
+	"bytes"
+	"github.com/glendsoza/sprobe/status"
 	"net"
 	"net/http"
 	"net/http/httptest"
-	"github.com/glendsoza/sprobe/status"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -54,8 +59,192 @@ func TestTcpHealthChecker(t *testing.T) {
 
 	prober := NewTcpProbe()
 	for _, tt := range tests {
-		status, _, err := prober.Probe(tt.host, tt.port, 1*time.Second)
+		status, _, err := prober.Probe("tcp", net.JoinHostPort(tt.host, strconv.Itoa(tt.port)), nil, 1*time.Second)
 		assert.Equal(t, tt.expectedStatus, status)
 		assert.Equal(t, tt.expectedError, err)
 	}
 }
+
+func startLineServer(t *testing.T, network string, address string, banner string, replies map[string]string) string {
+	lis, err := net.Listen(network, address)
+	assert.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if banner != "" {
+					conn.Write([]byte(banner))
+				}
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if reply, ok := replies[strings.TrimSpace(line)]; ok {
+						conn.Write([]byte(reply))
+					}
+				}
+			}(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestTcpSendExpect(t *testing.T) {
+	smtpAddr := startLineServer(t, "tcp", "127.0.0.1:0", "220 mail.test ESMTP\r\n", map[string]string{"QUIT": "221 bye\r\n"})
+	redisAddr := startLineServer(t, "tcp", "127.0.0.1:0", "", map[string]string{"PING": "+PONG\r\n"})
+
+	tests := []struct {
+		name           string
+		addr           string
+		steps          []TCPStep
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{
+			name:           "banner",
+			addr:           smtpAddr,
+			steps:          []TCPStep{{ExpectRegex: regexp.MustCompile(`^220 `)}},
+			expectedStatus: status.Success,
+			expectedOutput: "220 mail.test",
+		},
+		{
+			name: "banner then command",
+			addr: smtpAddr,
+			steps: []TCPStep{
+				{ExpectRegex: regexp.MustCompile(`^220 .*\r\n`)},
+				{Send: []byte("QUIT\r\n"), Expect: []byte("221")},
+			},
+			expectedStatus: status.Success,
+			expectedOutput: "221 bye",
+		},
+		{
+			name:           "ping pong",
+			addr:           redisAddr,
+			steps:          []TCPStep{{Send: []byte("PING\r\n"), Expect: []byte("+PONG\r\n")}},
+			expectedStatus: status.Success,
+			expectedOutput: "+PONG",
+		},
+		{
+			name:           "expect matches the start of the reply",
+			addr:           smtpAddr,
+			steps:          []TCPStep{{Expect: []byte("220 ")}},
+			expectedStatus: status.Success,
+			expectedOutput: "220 ",
+		},
+		{
+			name:           "wrong reply",
+			addr:           smtpAddr,
+			steps:          []TCPStep{{Expect: []byte("+PONG")}},
+			expectedStatus: status.Failure,
+			expectedOutput: "step 1: expected \"+PONG\", received \"220 mail.test",
+		},
+		{
+			name: "no reply",
+			addr: redisAddr,
+			steps: []TCPStep{
+				{Send: []byte("PING\r\n"), Expect: []byte("+PONG")},
+				{Send: []byte("INFO\r\n"), ExpectRegex: regexp.MustCompile(`role:`), Timeout: 100 * time.Millisecond},
+			},
+			expectedStatus: status.Failure,
+			expectedOutput: "step 2: expected match for \"role:\", received \"\": timed out",
+		},
+	}
+
+	prober := NewTcpProbe()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := prober.Probe("tcp", tt.addr, tt.steps, 1*time.Second)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
+
+func TestTcpReceiveLimit(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		chunk := bytes.Repeat([]byte("x"), 4096)
+		for {
+			if _, err := conn.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	s, output, err := NewTcpProbe().Probe("tcp", lis.Addr().String(),
+		[]TCPStep{{ExpectRegex: regexp.MustCompile(`role:`)}}, 5*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Equal(t, `step 1: expected match for "role:" within the first 65536 bytes received`, output)
+	assert.Less(t, time.Since(start), time.Second, "gives up without waiting for the deadline")
+}
+
+func TestTcpStepsShareTheDeadline(t *testing.T) {
+	addr := startLineServer(t, "tcp", "127.0.0.1:0", "", nil)
+
+	start := time.Now()
+	s, output, err := NewTcpProbe().Probe("tcp", addr, []TCPStep{
+		{Send: []byte("PING\r\n"), Expect: []byte("+PONG"), Timeout: 300 * time.Millisecond},
+		{Send: []byte("PING\r\n"), Expect: []byte("+PONG"), Timeout: 300 * time.Millisecond},
+	}, 500*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Contains(t, output, "step 1: expected \"+PONG\", received \"\": timed out")
+	assert.Less(t, time.Since(start), 400*time.Millisecond, "a step timeout shortens the deadline")
+
+	start = time.Now()
+	s, output, err = NewTcpProbe().Probe("tcp", addr, []TCPStep{
+		{Send: []byte("PING\r\n"), Expect: []byte("+PONG"), Timeout: 5 * time.Second},
+	}, 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Contains(t, output, "timed out")
+	assert.Less(t, time.Since(start), time.Second, "a step timeout does not extend the probe's")
+}
+
+func TestTcpUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	streamPath := filepath.Join(dir, "stream.sock")
+	packetPath := filepath.Join(dir, "packet.sock")
+	startLineServer(t, "unix", streamPath, "", map[string]string{"PING": "+PONG\r\n"})
+	startLineServer(t, "unixpacket", packetPath, "READY\n", nil)
+
+	tests := []struct {
+		name           string
+		network        string
+		addr           string
+		steps          []TCPStep
+		expectedStatus status.Status
+	}{
+		{"stream", "unix", streamPath, nil, status.Success},
+		{"stream ping", "unix", streamPath, []TCPStep{{Send: []byte("PING\r\n"), Expect: []byte("+PONG")}}, status.Success},
+		{"seqpacket", "unixpacket", packetPath, []TCPStep{{Expect: []byte("READY")}}, status.Success},
+		{"wrong socket type", "unix", packetPath, nil, status.Failure},
+		{"missing socket", "unix", filepath.Join(dir, "missing.sock"), nil, status.Failure},
+	}
+
+	prober := NewTcpProbe()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, err := prober.Probe(tt.network, tt.addr, tt.steps, 1*time.Second)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+		})
+	}
+}
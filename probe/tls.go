@@ -0,0 +1,88 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	certificateExpiryMetrics = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sprobe_tls_certificate_expiry_days",
+		Help: "Days until the leaf certificate presented by a probed endpoint expires; negative once expired",
+	},
+		[]string{"address", "server_name"})
+)
+
+type TlsProbe interface {
+	Probe(addr string, serverName string, roots *x509.CertPool, warnWithin time.Duration, timeout time.Duration) (status.Status, string, error)
+}
+
+type tlsProbe struct{}
+
+func NewTlsProbe() TlsProbe {
+	return tlsProbe{}
+}
+
+// Probe performs a TLS handshake against addr using serverName for SNI and
+// verifies the presented chain against roots, or the system pool when roots is
+// nil. An expired, untrusted or hostname-mismatched certificate is a Failure and
+// one expiring within warnWithin is a Warning.
+func (pr tlsProbe) Probe(addr string, serverName string, roots *x509.CertPool, warnWithin time.Duration, timeout time.Duration) (status.Status, string, error) {
+	d := &net.Dialer{Timeout: timeout}
+	// verification is done below so that expiry can still be reported for
+	// certificates that would fail the handshake
+	conn, err := tls.DialWithDialer(d, "tcp", addr, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return status.Failure, err.Error(), nil
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return status.Failure, "no certificate presented", nil
+	}
+	leaf := certs[0]
+	now := time.Now()
+	remaining := leaf.NotAfter.Sub(now)
+	certificateExpiryMetrics.WithLabelValues(addr, serverName).Set(remaining.Hours() / 24)
+
+	if now.After(leaf.NotAfter) {
+		return status.Failure, fmt.Sprintf("certificate expired on %s", leaf.NotAfter.UTC().Format(time.RFC3339)), nil
+	}
+	if now.Before(leaf.NotBefore) {
+		return status.Failure, fmt.Sprintf("certificate not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339)), nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	if err != nil {
+		return status.Failure, fmt.Sprintf("certificate is not trusted: %v", err), nil
+	}
+	if serverName != "" {
+		if err := leaf.VerifyHostname(serverName); err != nil {
+			return status.Failure, err.Error(), nil
+		}
+	}
+
+	if remaining < warnWithin {
+		return status.Warning, fmt.Sprintf("certificate expires in %d days on %s", int(remaining.Hours()/24), leaf.NotAfter.UTC().Format(time.RFC3339)), nil
+	}
+	return status.Success, fmt.Sprintf("certificate valid until %s", leaf.NotAfter.UTC().Format(time.RFC3339)), nil
+}
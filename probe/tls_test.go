@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sprobe test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) serve(t *testing.T, dnsName string, notBefore, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestTlsHealthChecker(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	now := time.Now()
+	day := 24 * time.Hour
+
+	valid := ca.serve(t, "svc.test", now.Add(-day), now.Add(90*day))
+	expiring := ca.serve(t, "svc.test", now.Add(-day), now.Add(3*day))
+	expired := ca.serve(t, "svc.test", now.Add(-10*day), now.Add(-day))
+	notYetValid := ca.serve(t, "svc.test", now.Add(day), now.Add(90*day))
+
+	tests := []struct {
+		name           string
+		addr           string
+		serverName     string
+		roots          *x509.CertPool
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"valid", valid, "svc.test", ca.pool, status.Success, "valid until"},
+		{"expiring", expiring, "svc.test", ca.pool, status.Warning, "expires in 2 days"},
+		{"expired", expired, "svc.test", ca.pool, status.Failure, "expired"},
+		{"not yet valid", notYetValid, "svc.test", ca.pool, status.Failure, "not valid before"},
+		{"untrusted", valid, "svc.test", otherCA.pool, status.Failure, "not trusted"},
+		{"hostname mismatch", valid, "other.test", ca.pool, status.Failure, "other.test"},
+		{"no server", "127.0.0.1:1", "svc.test", ca.pool, status.Failure, "refused"},
+	}
+
+	prober := NewTlsProbe()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := prober.Probe(tt.addr, tt.serverName, tt.roots, 14*day, 1*time.Second)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+)
+
+// UDPExchange is the datagram sent by the UDP probe and the optional reply
+// expected back. Without Expect or ExpectRegex any reply, or none at all,
+// is accepted.
+type UDPExchange struct {
+	Send        []byte
+	Expect      []byte
+	ExpectRegex *regexp.Regexp
+}
+
+func (ex UDPExchange) expectsReply() bool {
+	return ex.Expect != nil || ex.ExpectRegex != nil
+}
+
+// UdpProbe sends a datagram to addr on "udp", "udp4" or "udp6".
+type UdpProbe interface {
+	Probe(network string, addr string, exchange UDPExchange, timeout time.Duration) (status.Status, string, error)
+}
+
+type udpProbe struct{}
+
+func NewUdpProbe() UdpProbe {
+	return udpProbe{}
+}
+
+// Probe sends exchange.Send and waits up to timeout for a reply. The socket is
+// connected, so an ICMP port unreachable answer surfaces as ECONNREFUSED and
+// is reported as a Failure even when no reply is expected.
+func (pr udpProbe) Probe(network string, addr string, exchange UDPExchange, timeout time.Duration) (status.Status, string, error) {
+	conn, err := net.DialTimeout(network, addr, timeout)
+	if err != nil {
+		return status.Failure, err.Error(), nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(exchange.Send); err != nil {
+		return udpError(err, exchange)
+	}
+
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return udpError(err, exchange)
+	}
+	reply := buf[:n]
+	switch {
+	case exchange.Expect != nil && !bytes.HasPrefix(reply, exchange.Expect):
+		return status.Failure, fmt.Sprintf("expected %q, received %q", exchange.Expect, reply), nil
+	case exchange.ExpectRegex != nil && !exchange.ExpectRegex.Match(reply):
+		return status.Failure, fmt.Sprintf("expected match for %q, received %q", exchange.ExpectRegex.String(), reply), nil
+	}
+	return status.Success, string(reply), nil
+}
+
+func udpError(err error, exchange UDPExchange) (status.Status, string, error) {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return status.Failure, "port unreachable", nil
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		if exchange.expectsReply() {
+			return status.Failure, "no reply received: timed out", nil
+		}
+		return status.Success, "no reply received", nil
+	}
+	return status.Failure, err.Error(), nil
+}
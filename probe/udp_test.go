@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+// startUDPServer replies "pong <payload>" to datagrams starting with "ping"
+// and ignores everything else.
+func startUDPServer(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if rest, ok := bytes.CutPrefix(buf[:n], []byte("ping")); ok {
+				pc.WriteTo(append([]byte("pong"), rest...), addr)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestUDPProbe(t *testing.T) {
+	addr := startUDPServer(t)
+	tests := []struct {
+		name           string
+		exchange       UDPExchange
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"expect", UDPExchange{Send: []byte("ping 1"), Expect: []byte("pong")}, status.Success, "pong 1"},
+		{"expect regex", UDPExchange{Send: []byte("ping 42"), ExpectRegex: regexp.MustCompile(`pong \d+`)}, status.Success, "pong 42"},
+		{"unexpected reply", UDPExchange{Send: []byte("ping"), Expect: []byte("PONG")}, status.Failure, `expected "PONG", received "pong"`},
+		{"no reply", UDPExchange{Send: []byte("hello"), Expect: []byte("pong")}, status.Failure, "no reply received: timed out"},
+		{"fire and forget", UDPExchange{Send: []byte("hello")}, status.Success, "no reply received"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := NewUdpProbe().Probe("udp", addr, tt.exchange, 200*time.Millisecond)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Equal(t, tt.expectedOutput, output)
+		})
+	}
+}
+
+func TestUDPProbePortUnreachable(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	s, output, err := NewUdpProbe().Probe("udp", addr, UDPExchange{Send: []byte("hello")}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Failure, s)
+	assert.Equal(t, "port unreachable", output)
+}
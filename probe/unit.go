@@ -0,0 +1,90 @@
+package probe
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/glendsoza/sprobe/sysd"
+)
+
+type UnitStateReader interface {
+	State(unitName string) (*sysd.UnitState, error)
+}
+
+type UnitProbe interface {
+	Probe(unitName string, maxActivating time.Duration, maxRestarts int, restartWindow time.Duration) (status.Status, string, error)
+}
+
+type restartSample struct {
+	at        time.Time
+	nRestarts uint32
+}
+
+type unitProbe struct {
+	units UnitStateReader
+	now   func() time.Time
+
+	mutex    sync.Mutex
+	restarts map[string][]restartSample
+}
+
+func NewUnitProbe(units UnitStateReader) UnitProbe {
+	return &unitProbe{
+		units:    units,
+		now:      time.Now,
+		restarts: map[string][]restartSample{},
+	}
+}
+
+// Probe fails when the unit is failed or inactive, has been activating for
+// longer than maxActivating, which it is given to start up, or was restarted by systemd more than
+// maxRestarts times within restartWindow. A zero maxActivating or maxRestarts
+// disables the respective check.
+func (pr *unitProbe) Probe(unitName string, maxActivating time.Duration, maxRestarts int, restartWindow time.Duration) (status.Status, string, error) {
+	state, err := pr.units.State(unitName)
+	if err != nil {
+		return status.Unknown, "", err
+	}
+	now := pr.now()
+	output := fmt.Sprintf("ActiveState=%s SubState=%s Result=%s NRestarts=%d ExecMainStatus=%d",
+		state.ActiveState, state.SubState, state.Result, state.NRestarts, state.ExecMainStatus)
+
+	restarts := pr.restartsInWindow(unitName, state.NRestarts, now, restartWindow)
+	if maxRestarts > 0 && restarts > maxRestarts {
+		return status.Failure, fmt.Sprintf("unit restarted %d times in %v, %s", restarts, restartWindow, output), nil
+	}
+
+	switch state.ActiveState {
+	case "active", "reloading":
+		return status.Success, output, nil
+	case "activating":
+		if maxActivating > 0 && !state.StateChangeTimestamp.IsZero() && now.Sub(state.StateChangeTimestamp) > maxActivating {
+			return status.Failure, fmt.Sprintf("unit stuck activating since %s, %s", state.StateChangeTimestamp.UTC().Format(time.RFC3339), output), nil
+		}
+		return status.Success, output, nil
+	default:
+		return status.Failure, output, nil
+	}
+}
+
+// restartsInWindow records the current NRestarts counter and returns how much
+// it grew over the samples still inside window.
+func (pr *unitProbe) restartsInWindow(unitName string, nRestarts uint32, now time.Time, window time.Duration) int {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	samples := pr.restarts[unitName]
+	// the counter is reset when the unit is reset-failed or reloaded
+	if len(samples) > 0 && nRestarts < samples[len(samples)-1].nRestarts {
+		samples = nil
+	}
+	samples = append(samples, restartSample{at: now, nRestarts: nRestarts})
+	cutoff := 0
+	for cutoff < len(samples)-1 && now.Sub(samples[cutoff].at) > window {
+		cutoff++
+	}
+	samples = samples[cutoff:]
+	pr.restarts[unitName] = samples
+	return int(nRestarts - samples[0].nRestarts)
+}
@@ -0,0 +1,82 @@
+package probe
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/glendsoza/sprobe/sysd"
+	"github.com/stretchr/testify/assert"
+)
+
+type FakeUnits struct {
+	state *sysd.UnitState
+	err   error
+}
+
+func (f *FakeUnits) State(unitName string) (*sysd.UnitState, error) {
+	return f.state, f.err
+}
+
+func TestUnitProbeStates(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		state          *sysd.UnitState
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"active", &sysd.UnitState{ActiveState: "active", SubState: "running"}, status.Success, "ActiveState=active SubState=running"},
+		{"reloading", &sysd.UnitState{ActiveState: "reloading"}, status.Success, "ActiveState=reloading"},
+		{"failed", &sysd.UnitState{ActiveState: "failed", Result: "exit-code", ExecMainStatus: 2}, status.Failure, "Result=exit-code NRestarts=0 ExecMainStatus=2"},
+		{"inactive", &sysd.UnitState{ActiveState: "inactive", SubState: "dead"}, status.Failure, "ActiveState=inactive"},
+		{"activating", &sysd.UnitState{ActiveState: "activating", StateChangeTimestamp: now.Add(-10 * time.Second)}, status.Success, "ActiveState=activating"},
+		{"stuck activating", &sysd.UnitState{ActiveState: "activating", StateChangeTimestamp: now.Add(-2 * time.Minute)}, status.Failure, "stuck activating since 2024-01-01T11:58:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober := NewUnitProbe(&FakeUnits{state: tt.state}).(*unitProbe)
+			prober.now = func() time.Time { return now }
+			s, output, err := prober.Probe("test.service", time.Minute, 0, time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
+
+func TestUnitProbeError(t *testing.T) {
+	prober := NewUnitProbe(&FakeUnits{err: fmt.Errorf("no such unit")})
+	s, _, err := prober.Probe("test.service", 0, 0, time.Minute)
+	assert.Error(t, err)
+	assert.Equal(t, status.Unknown, s)
+}
+
+func TestUnitProbeRestartWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	units := &FakeUnits{state: &sysd.UnitState{ActiveState: "active"}}
+	prober := NewUnitProbe(units).(*unitProbe)
+	prober.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance        time.Duration
+		nRestarts      uint32
+		expectedStatus status.Status
+	}{
+		{0, 5, status.Success},                // first sample is the baseline
+		{30 * time.Second, 6, status.Success}, // 1 restart in window
+		{30 * time.Second, 8, status.Failure}, // 3 restarts in window
+		{90 * time.Second, 8, status.Success}, // earlier restarts left the window
+		{10 * time.Second, 0, status.Success}, // counter reset
+		{10 * time.Second, 2, status.Success},
+		{10 * time.Second, 3, status.Failure},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		units.state.NRestarts = step.nRestarts
+		s, _, err := prober.Probe("test.service", 0, 2, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, step.expectedStatus, s, "step %d", i)
+	}
+}
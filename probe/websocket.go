@@ -0,0 +1,85 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketExchange is the text message sent after the handshake and the
+// reply expected back. An empty Send skips the exchange.
+type WebSocketExchange struct {
+	Send        []byte
+	Expect      []byte
+	ExpectRegex *regexp.Regexp
+}
+
+type WebsocketProbe interface {
+	Probe(url string, header http.Header, tlsConfig *tls.Config, exchange WebSocketExchange, timeout time.Duration) (status.Status, string, error)
+}
+
+type websocketProbe struct{}
+
+func NewWebsocketProbe() WebsocketProbe {
+	return websocketProbe{}
+}
+
+// Probe performs the upgrade handshake against a ws:// or wss:// url. A
+// response other than 101 Switching Protocols is a Failure reporting the
+// status code, as is a reply to exchange.Send that does not match.
+func (pr websocketProbe) Probe(url string, header http.Header, tlsConfig *tls.Config, exchange WebSocketExchange, timeout time.Duration) (status.Status, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// like the http probe, services are dialed directly and never through
+	// HTTP(S)_PROXY
+	dialer := websocket.Dialer{
+		HandshakeTimeout: timeout,
+		TLSClientConfig:  tlsConfig,
+	}
+	conn, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil {
+			return status.Failure, fmt.Sprintf("handshake failed with status %s", resp.Status), nil
+		}
+		return status.Failure, err.Error(), nil
+	}
+	defer conn.Close()
+	output := fmt.Sprintf("handshake completed with status %s", resp.Status)
+
+	if len(exchange.Send) > 0 {
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		if err := conn.WriteMessage(websocket.TextMessage, exchange.Send); err != nil {
+			return status.Failure, fmt.Sprintf("%s, send: %v", output, err), nil
+		}
+		if exchange.Expect != nil || exchange.ExpectRegex != nil {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			_, reply, err := conn.ReadMessage()
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					err = errors.New("timed out")
+				}
+				return status.Failure, fmt.Sprintf("%s, no reply received: %v", output, err), nil
+			}
+			switch {
+			case exchange.Expect != nil && !bytes.HasPrefix(reply, exchange.Expect):
+				return status.Failure, fmt.Sprintf("%s, expected %q, received %q", output, exchange.Expect, reply), nil
+			case exchange.ExpectRegex != nil && !exchange.ExpectRegex.Match(reply):
+				return status.Failure, fmt.Sprintf("%s, expected match for %q, received %q", output, exchange.ExpectRegex.String(), reply), nil
+			}
+			output = fmt.Sprintf("%s, received %q", output, reply)
+		}
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(timeout))
+	return status.Success, output, nil
+}
@@ -0,0 +1,75 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/status"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// startWebsocketServer echoes messages upper cased on /ws and answers 200 on
+// every other path, like a gateway whose upgrade route is missing.
+func startWebsocketServer(t *testing.T) string {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "ignore" {
+				continue
+			}
+			conn.WriteMessage(mt, []byte(strings.ToUpper(string(msg))))
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestWebsocketProbe(t *testing.T) {
+	url := startWebsocketServer(t)
+	header := http.Header{"Authorization": {"Bearer token"}}
+	tests := []struct {
+		name           string
+		path           string
+		header         http.Header
+		exchange       WebSocketExchange
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"handshake", "/ws", header, WebSocketExchange{}, status.Success, "handshake completed with status 101 Switching Protocols"},
+		{"echo", "/ws", header, WebSocketExchange{Send: []byte("ping"), Expect: []byte("PING")}, status.Success, `handshake completed with status 101 Switching Protocols, received "PING"`},
+		{"echo regex", "/ws", header, WebSocketExchange{Send: []byte("ping 7"), ExpectRegex: regexp.MustCompile(`^PING \d$`)}, status.Success, `received "PING 7"`},
+		{"unexpected reply", "/ws", header, WebSocketExchange{Send: []byte("ping"), Expect: []byte("pong")}, status.Failure, `expected "pong", received "PING"`},
+		{"no reply", "/ws", header, WebSocketExchange{Send: []byte("ignore"), Expect: []byte("IGNORE")}, status.Failure, "no reply received: timed out"},
+		{"unauthorized", "/ws", nil, WebSocketExchange{}, status.Failure, "handshake failed with status 401 Unauthorized"},
+		{"not upgraded", "/health", header, WebSocketExchange{}, status.Failure, "handshake failed with status 200 OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, output, err := NewWebsocketProbe().Probe(url+tt.path, tt.header, nil, tt.exchange, 200*time.Millisecond)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, s)
+			assert.Contains(t, output, tt.expectedOutput)
+		})
+	}
+}
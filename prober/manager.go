@@ -22,6 +22,11 @@ var (
 		Help: "Health status of services: 0 = healthy, 1 = unhealthy, -1 = unknown",
 	},
 		[]string{"service_name"})
+	probeMetrics = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sprobe_probe_metric",
+		Help: "Values reported by probes, e.g. the performance data of Nagios plugins",
+	},
+		[]string{"service_name", "metric"})
 )
 
 type ServiceHealth struct {
@@ -34,21 +39,34 @@ type ProberManager struct {
 	serviceHealth      map[string]*ServiceHealth
 	serviceHealthMutex sync.RWMutex
 	probes             map[string]chan int
+	unitEvents         map[string]chan sysd.UnitEvent
 	probesMutex        sync.RWMutex
 	unitsManager       sysd.Units
+	restarts           *restartTracker
+	silences           *silencer
 }
 
-func NewProberManager(prober Prober) (*ProberManager, error) {
-	unitsManger, err := sysd.New()
-	if err != nil {
-		return nil, err
-	}
+func NewProberManager(prober Prober, units sysd.Units) *ProberManager {
 	return &ProberManager{
 		prober:        prober,
 		serviceHealth: make(map[string]*ServiceHealth),
 		probes:        map[string]chan int{},
-		unitsManager:  unitsManger,
-	}, nil
+		unitEvents:    map[string]chan sysd.UnitEvent{},
+		unitsManager:  units,
+		restarts:      newRestartTracker(""),
+		silences:      newSilencer(""),
+	}
+}
+
+// LoadRestartState restores the restart history from path and keeps it up to
+// date there. It must be called before any service is added.
+func (pm *ProberManager) LoadRestartState(path string) error {
+	restarts := newRestartTracker(path)
+	if err := restarts.load(); err != nil {
+		return err
+	}
+	pm.restarts = restarts
+	return nil
 }
 
 func (pm *ProberManager) stopProbe(serviceName string) error {
@@ -59,62 +77,386 @@ func (pm *ProberManager) stopProbe(serviceName string) error {
 		return fmt.Errorf("unable to find the probe %s", serviceName)
 	}
 	c <- 1
+	pm.prober.stop(serviceName)
+	pm.silences.probingChanged(serviceName, "")
 	delete(pm.probes, serviceName)
+	delete(pm.unitEvents, serviceName)
 	delete(pm.serviceHealth, serviceName)
 	return nil
 }
 
-func (pm *ProberManager) startProbe(spec *spec.LivenessProbe, stopChan chan int) {
+type probeOutcome int
+
+const (
+	probeStopped probeOutcome = iota
+	probeRestarted
+	probeStarted
+)
+
+func (pm *ProberManager) startProbe(spec *spec.LivenessProbe, stopChan chan int, unitEvents chan sysd.UnitEvent) {
+	for {
+		outcome := pm.runStartupProbe(spec, stopChan, unitEvents)
+		if outcome == probeStarted {
+			outcome = pm.runProbes(spec, stopChan, unitEvents)
+		}
+		if outcome == probeStopped {
+			return
+		}
+	}
+}
+
+// runStartupProbe probes until the startup probe succeeds, holding back the
+// liveness and readiness probes meanwhile. Services without a startup probe
+// are started right away.
+func (pm *ProberManager) runStartupProbe(spec *spec.LivenessProbe, stopChan chan int, unitEvents chan sysd.UnitEvent) probeOutcome {
+	startup := spec.StartupProbe
+	if startup == nil {
+		return probeStarted
+	}
+	if outcome, ok := pm.waitInitialDelay(spec, *startup.InitialDelaySeconds, stopChan, unitEvents); ok {
+		return outcome
+	}
+	counter := &probeCounter{probe: startup}
+	ticker := time.NewTicker(time.Duration(*startup.PeriodSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if pm.probingSilenced(spec.ServiceName) {
+				continue
+			}
+			probeResult := pm.runProbe(spec, "startup", startup)
+			h, reached := counter.record(probeResult)
+			if !reached {
+				continue
+			}
+			if h == health.Healthy {
+				log.Info().Str("service_name", spec.ServiceName).Msg("started")
+				return probeStarted
+			}
+			pm.updateServiceHealth(spec.ServiceName, health.UnHealthy, probeResult)
+			pm.remediate(spec)
+			return probeRestarted
+		case ev := <-unitEvents:
+			if outcome, ok := pm.handleUnitEvent(spec, ev, stopChan, unitEvents); ok {
+				return outcome
+			}
+		case <-stopChan:
+			return probeStopped
+		}
+	}
+}
+
+// runProbes runs the liveness and readiness probes side by side. Reaching
+// the liveness failure threshold reports the service unhealthy, restarts it
+// and returns. Otherwise the readiness probe, when defined, takes over
+// reporting the health.
+func (pm *ProberManager) runProbes(spec *spec.LivenessProbe, stopChan chan int, unitEvents chan sysd.UnitEvent) probeOutcome {
+	liveness, readiness := spec.LivenessProbe, spec.ReadinessProbe
+	initialDelay := minInitialDelay(liveness, readiness)
+	if outcome, ok := pm.waitInitialDelay(spec, initialDelay, stopChan, unitEvents); ok {
+		return outcome
+	}
+	livenessTimer := newProbeTimer(liveness, initialDelay)
+	defer livenessTimer.stop()
+	readinessTimer := newProbeTimer(readiness, initialDelay)
+	defer readinessTimer.stop()
+	livenessCounter := &probeCounter{probe: liveness}
+	readinessCounter := &probeCounter{probe: readiness}
 	for {
-		failureCount := 0
-		successCount := 0
-		time.Sleep(time.Duration(*spec.InitialDelaySeconds) * time.Second)
-		ticker := time.NewTicker(time.Duration(*spec.PeriodSeconds) * time.Second)
-	OUTER:
-		for {
+		select {
+		case <-livenessTimer.c():
+			livenessTimer.reset()
+			if pm.probingSilenced(spec.ServiceName) {
+				continue
+			}
+			probeResult := pm.runProbe(spec, "liveness", liveness)
+			h, reached := livenessCounter.record(probeResult)
+			if !reached {
+				continue
+			}
+			if h == health.UnHealthy {
+				pm.updateServiceHealth(spec.ServiceName, health.UnHealthy, probeResult)
+				pm.remediate(spec)
+				return probeRestarted
+			}
+			if readiness == nil {
+				pm.updateServiceHealth(spec.ServiceName, health.Healthy, probeResult)
+			}
+		case <-readinessTimer.c():
+			readinessTimer.reset()
+			if pm.probingSilenced(spec.ServiceName) {
+				continue
+			}
+			probeResult := pm.runProbe(spec, "readiness", readiness)
+			if h, reached := readinessCounter.record(probeResult); reached {
+				pm.updateServiceHealth(spec.ServiceName, h, probeResult)
+			}
+		case ev := <-unitEvents:
+			if outcome, ok := pm.handleUnitEvent(spec, ev, stopChan, unitEvents); ok {
+				return outcome
+			}
+		case <-stopChan:
+			return probeStopped
+		}
+	}
+}
+
+func (pm *ProberManager) runProbe(spec *spec.LivenessProbe, kind string, p *spec.Probe) *ProbeResult {
+	log.Info().Str("service_name", spec.ServiceName).Str("probe", kind).Msg("probing")
+	probeResult := pm.prober.probe(spec.ServiceName, kind, p)
+	log.Info().Str("service_name", spec.ServiceName).
+		Str("probe", kind).
+		Str("status", probeResult.Status.String()).
+		Str("output", probeResult.Output).
+		Err(probeResult.Error).
+		Msg("result")
+	recordProbeMetrics(spec.ServiceName, probeResult)
+	for _, subResult := range probeResult.SubResults {
+		log.Info().Str("service_name", spec.ServiceName).
+			Str("probe", kind).
+			Str("check", subResult.Name).
+			Str("status", subResult.Status.String()).
+			Str("output", subResult.Output).
+			Err(subResult.Error).
+			Msg("check result")
+	}
+	return probeResult
+}
+
+func recordProbeMetrics(serviceName string, probeResult *ProbeResult) {
+	for metric, value := range probeResult.Metrics {
+		probeMetrics.WithLabelValues(serviceName, metric).Set(value)
+	}
+	for _, subResult := range probeResult.SubResults {
+		recordProbeMetrics(serviceName, subResult)
+	}
+}
+
+// waitInitialDelay waits before a round of probes, unless the service is
+// stopped meanwhile. Events buffered during the delay are stale, e.g. those of
+// a restart we triggered, so only the latest state matters. It returns false
+// when probing should go ahead.
+func (pm *ProberManager) waitInitialDelay(spec *spec.LivenessProbe, seconds int, stopChan chan int, unitEvents chan sysd.UnitEvent) (probeOutcome, bool) {
+	select {
+	case <-time.After(time.Duration(seconds) * time.Second):
+	case <-stopChan:
+		return probeStopped, true
+	}
+	if ev, ok := latestUnitEvent(unitEvents); ok {
+		return pm.handleUnitEvent(spec, ev, stopChan, unitEvents)
+	}
+	return 0, false
+}
+
+// handleUnitEvent reacts to a systemd event of the unit. It returns false when
+// the event does not interrupt probing.
+func (pm *ProberManager) handleUnitEvent(spec *spec.LivenessProbe, ev sysd.UnitEvent, stopChan chan int, unitEvents chan sysd.UnitEvent) (probeOutcome, bool) {
+	switch unitEventAction(ev) {
+	case unitFailed:
+		pm.markUnitFailed(spec, ev)
+		return probeRestarted, true
+	case unitStopped:
+		if !pm.pauseProbe(spec, ev, unitEvents, stopChan) {
+			return probeStopped, true
+		}
+		return probeRestarted, true
+	}
+	return 0, false
+}
+
+func minInitialDelay(probes ...*spec.Probe) int {
+	initialDelay := -1
+	for _, p := range probes {
+		if p != nil && (initialDelay < 0 || *p.InitialDelaySeconds < initialDelay) {
+			initialDelay = *p.InitialDelaySeconds
+		}
+	}
+	return initialDelay
+}
+
+// probeCounter tracks consecutive results of a probe against its thresholds.
+type probeCounter struct {
+	probe        *spec.Probe
+	failureCount int
+	successCount int
+}
+
+// record returns the health a result settles on and whether the matching
+// threshold was reached.
+func (c *probeCounter) record(probeResult *ProbeResult) (health.Health, bool) {
+	if probeResult.Status != status.Success && !(probeResult.Status == status.Warning && c.toleratesWarning()) {
+		c.successCount = 0
+		c.failureCount += 1
+		return health.UnHealthy, c.failureCount >= *c.probe.FailureThreshold
+	}
+	c.failureCount = 0
+	c.successCount += 1
+	if c.successCount >= *c.probe.SuccessThreshold {
+		c.successCount = 0
+		return health.Healthy, true
+	}
+	return health.Unknown, false
+}
+
+// toleratesWarning reports whether a warning is surfaced in the result without
+// counting towards the failure threshold. That is the case for a resource
+// approaching its limit, for a certificate nearing its expiry, which no
+// restart fixes, and for checks that passed as a whole; any other warning,
+// e.g. an HTTP 3xx, is a failure.
+func (c *probeCounter) toleratesWarning() bool {
+	return len(c.probe.Checks) > 0 || handlerToleratesWarning(&c.probe.ProbeHandler)
+}
+
+// handlerToleratesWarning reports whether a warning of the probe type passes,
+// on its own or as one of checks.
+func handlerToleratesWarning(ph *spec.ProbeHandler) bool {
+	return ph.Resources != nil || ph.TLS != nil
+}
+
+// probeTimer fires after a probe's remaining initial delay plus its period,
+// then every period. A timer for an undefined probe never fires.
+type probeTimer struct {
+	probe *spec.Probe
+	timer *time.Timer
+}
+
+func newProbeTimer(p *spec.Probe, elapsedSeconds int) *probeTimer {
+	if p == nil {
+		return &probeTimer{}
+	}
+	first := time.Duration(*p.InitialDelaySeconds-elapsedSeconds+*p.PeriodSeconds) * time.Second
+	return &probeTimer{probe: p, timer: time.NewTimer(first)}
+}
+
+func (t *probeTimer) c() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+func (t *probeTimer) reset() {
+	t.timer.Reset(time.Duration(*t.probe.PeriodSeconds) * time.Second)
+}
+
+func (t *probeTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+type unitEventKind int
+
+const (
+	unitIgnored unitEventKind = iota
+	unitFailed
+	unitStopped
+)
+
+func unitEventAction(ev sysd.UnitEvent) unitEventKind {
+	switch {
+	case ev.Type == sysd.UnitRemoved:
+		return unitStopped
+	case ev.Type == sysd.UnitChanged && ev.ActiveState == "failed":
+		return unitFailed
+	case ev.Type == sysd.UnitChanged && ev.ActiveState == "inactive":
+		return unitStopped
+	}
+	return unitIgnored
+}
+
+func latestUnitEvent(unitEvents chan sysd.UnitEvent) (sysd.UnitEvent, bool) {
+	var latest sysd.UnitEvent
+	found := false
+	for {
+		select {
+		case ev := <-unitEvents:
+			latest = ev
+			found = true
+		default:
+			return latest, found
+		}
+	}
+}
+
+// markUnitFailed flips the service to unhealthy as soon as systemd reports the
+// unit failed instead of waiting for the failure threshold.
+func (pm *ProberManager) markUnitFailed(spec *spec.LivenessProbe, ev sysd.UnitEvent) {
+	probeResult := NewProbeResult().
+		WithStatus(status.Failure).
+		WithOutput(fmt.Sprintf("systemd reported the unit %s (%s)", ev.ActiveState, ev.SubState))
+	log.Info().Str("service_name", spec.ServiceName).
+		Str("status", probeResult.Status.String()).
+		Str("output", probeResult.Output).
+		Msg("unit failed")
+	pm.updateServiceHealth(spec.ServiceName, health.UnHealthy, probeResult)
+	pm.remediate(spec)
+}
+
+// pauseProbe marks a unit that was stopped on purpose as unhealthy and blocks
+// until systemd reports it active again. It returns false when the probe was
+// stopped while waiting.
+func (pm *ProberManager) pauseProbe(spec *spec.LivenessProbe, ev sysd.UnitEvent, unitEvents chan sysd.UnitEvent, stopChan chan int) bool {
+	probeResult := NewProbeResult().
+		WithStatus(status.Failure).
+		WithOutput(fmt.Sprintf("unit is %s, probing paused", unitStateDescription(ev)))
+	pm.updateServiceHealth(spec.ServiceName, health.UnHealthy, probeResult)
+	log.Info().Str("service_name", spec.ServiceName).
+		Str("output", probeResult.Output).
+		Msg("paused")
+	for {
+		select {
+		case ev := <-unitEvents:
+			if ev.Type == sysd.UnitChanged && ev.ActiveState == "active" {
+				log.Info().Str("service_name", spec.ServiceName).Msg("resumed")
+				return true
+			}
+			// the unit was started again but did not come up
+			if unitEventAction(ev) == unitFailed {
+				pm.markUnitFailed(spec, ev)
+				return true
+			}
+		case <-stopChan:
+			return false
+		}
+	}
+}
+
+func unitStateDescription(ev sysd.UnitEvent) string {
+	if ev.Type == sysd.UnitRemoved {
+		return "unloaded"
+	}
+	return ev.ActiveState
+}
+
+// HandleUnitEvents forwards systemd unit events to the probes of the matching
+// services until events is closed.
+func (pm *ProberManager) HandleUnitEvents(events <-chan sysd.UnitEvent) {
+	for ev := range events {
+		pm.probesMutex.RLock()
+		c, ok := pm.unitEvents[ev.Unit]
+		if ok {
 			select {
-			case <-ticker.C:
-				log.Info().Str("service_name", spec.ServiceName).Msg("probing")
-				probeResult := pm.prober.probe(spec)
-				log.Info().Str("service_name", spec.ServiceName).
-					Str("status", probeResult.Status.String()).
-					Str("output", probeResult.Output).
-					Err(probeResult.Error).
-					Msg("result")
-				if probeResult.Status != status.Success {
-					failureCount += 1
-					if failureCount >= *spec.FailureThreshold {
-						pm.updateServiceHealth(spec.ServiceName, health.UnHealthy, probeResult)
-						ticker.Stop()
-						if *spec.AutoRestart {
-							output, err := pm.unitsManager.Restart(spec.ServiceName)
-							log.Info().Str("service_name", spec.ServiceName).
-								Str("output", output).
-								Err(err).
-								Msg("restarted")
-						}
-						break OUTER
-					}
-				} else {
-					failureCount = 0
-					successCount += 1
-					if successCount >= *spec.SuccessThreshold {
-						successCount = 0
-						pm.updateServiceHealth(spec.ServiceName, health.Healthy, probeResult)
-					}
-				}
-			case <-stopChan:
-				return
+			case c <- ev:
+			default:
+				log.Warn().Str("service_name", ev.Unit).
+					Str("event", ev.Type.String()).
+					Msg("dropping unit event, probe is not keeping up")
 			}
 		}
+		pm.probesMutex.RUnlock()
 	}
 }
 
-func (pm *ProberManager) updateServiceHealth(serviceName string, health health.Health, pr *ProbeResult) {
-	healthMetrics.WithLabelValues(serviceName).Set(float64(health))
+func (pm *ProberManager) updateServiceHealth(serviceName string, h health.Health, pr *ProbeResult) {
+	healthMetrics.WithLabelValues(serviceName).Set(float64(h))
+	if h == health.Healthy {
+		pm.restarts.recovered(serviceName)
+	}
 	pm.serviceHealthMutex.Lock()
 	defer pm.serviceHealthMutex.Unlock()
-	pm.serviceHealth[serviceName].health = health
+	pm.serviceHealth[serviceName].health = h
 	pm.serviceHealth[serviceName].probeResult = pr
 }
 
@@ -139,7 +481,9 @@ func (pm *ProberManager) Add(spec *spec.LivenessProbe) error {
 	defer pm.probesMutex.Unlock()
 	pm.serviceHealth[spec.ServiceName] = &ServiceHealth{health: health.Unknown}
 	stopChan := make(chan int)
+	unitEvents := make(chan sysd.UnitEvent, 16)
 	pm.probes[spec.ServiceName] = stopChan
-	go pm.startProbe(spec, stopChan)
+	pm.unitEvents[spec.ServiceName] = unitEvents
+	go pm.startProbe(spec, stopChan, unitEvents)
 	return nil
 }
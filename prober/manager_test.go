@@ -2,33 +2,87 @@ package prober
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/glendsoza/sprobe/health"
+	"github.com/glendsoza/sprobe/probe"
 	"github.com/glendsoza/sprobe/spec"
 	"github.com/glendsoza/sprobe/status"
+	"github.com/glendsoza/sprobe/sysd"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
 type DummyUnits struct {
+	restarts atomic.Int32
+	mu       sync.Mutex
+	actions  []string
+	requires []string
+	// activeState is reported by State, defaulting to active
+	activeState string
 }
 
 func (du *DummyUnits) Exists(serviceName string) (bool, error) {
 	return true, nil
 }
-func (du *DummyUnits) Restart(serviceName string) (string, error) {
-	return "done", nil
+func (du *DummyUnits) Restart(unitName string, mode string, timeout time.Duration) (string, error) {
+	du.restarts.Add(1)
+	return du.record("restart %s %s", unitName, mode), nil
+}
+func (du *DummyUnits) Reload(unitName string, mode string, timeout time.Duration) (string, error) {
+	return du.record("reload %s %s", unitName, mode), nil
+}
+func (du *DummyUnits) Start(unitName string, mode string, timeout time.Duration) (string, error) {
+	return du.record("start %s %s", unitName, mode), nil
+}
+func (du *DummyUnits) Stop(unitName string, mode string, timeout time.Duration) (string, error) {
+	return du.record("stop %s %s", unitName, mode), nil
+}
+func (du *DummyUnits) Kill(unitName string, who string, signal syscall.Signal, timeout time.Duration) error {
+	du.record("kill %s %s %v", unitName, who, signal)
+	return nil
+}
+func (du *DummyUnits) ResetFailed(unitName string, timeout time.Duration) error {
+	du.record("reset-failed %s", unitName)
+	return nil
+}
+
+// record notes an action and returns "done" as systemd does for jobs.
+func (du *DummyUnits) record(format string, args ...any) string {
+	du.mu.Lock()
+	defer du.mu.Unlock()
+	du.actions = append(du.actions, fmt.Sprintf(format, args...))
+	return "done"
+}
+
+func (du *DummyUnits) recorded() []string {
+	du.mu.Lock()
+	defer du.mu.Unlock()
+	return append([]string(nil), du.actions...)
+}
+func (du *DummyUnits) State(unitName string) (*sysd.UnitState, error) {
+	if du.activeState != "" {
+		return &sysd.UnitState{Name: unitName, ActiveState: du.activeState, SubState: du.activeState, Requires: du.requires}, nil
+	}
+	return &sysd.UnitState{Name: unitName, ActiveState: "active", SubState: "running", Requires: du.requires}, nil
 }
 
 var dummyTestSpec = &spec.LivenessProbe{
-	ServiceName:         "test",
-	InitialDelaySeconds: spec.ToIntRef(0),
-	PeriodSeconds:       spec.ToIntRef(1),
-	TimeoutSeconds:      spec.ToIntRef(10),
-	FailureThreshold:    spec.ToIntRef(0),
-	SuccessThreshold:    spec.ToIntRef(0),
+	ServiceName: "test",
+	Probe: spec.Probe{
+		InitialDelaySeconds: spec.ToIntRef(0),
+		PeriodSeconds:       spec.ToIntRef(1),
+		TimeoutSeconds:      spec.ToIntRef(10),
+		FailureThreshold:    spec.ToIntRef(0),
+		SuccessThreshold:    spec.ToIntRef(0),
+	},
 }
 
 func TestProberManager_StartStopProbe(t *testing.T) {
@@ -42,6 +96,9 @@ func TestProberManager_StartStopProbe(t *testing.T) {
 		unitsManager:  &DummyUnits{},
 		serviceHealth: map[string]*ServiceHealth{},
 		probes:        map[string]chan int{},
+		unitEvents:    map[string]chan sysd.UnitEvent{},
+		restarts:      newRestartTracker(""),
+		silences:      newSilencer(""),
 	}
 	dummyTestSpec.Exec = &spec.ExecProbe{
 		Command: []string{"test"},
@@ -63,6 +120,9 @@ func TestProberManager_ServiceHealthHealthy(t *testing.T) {
 		unitsManager:  &DummyUnits{},
 		serviceHealth: map[string]*ServiceHealth{},
 		probes:        map[string]chan int{},
+		unitEvents:    map[string]chan sysd.UnitEvent{},
+		restarts:      newRestartTracker(""),
+		silences:      newSilencer(""),
 	}
 	dummyTestSpec.InitialDelaySeconds = spec.ToIntRef(2)
 	dummyTestSpec.Exec = &spec.ExecProbe{
@@ -88,6 +148,9 @@ func TestProberManager_ServiceHealthUnHealthy(t *testing.T) {
 		unitsManager:  &DummyUnits{},
 		serviceHealth: map[string]*ServiceHealth{},
 		probes:        map[string]chan int{},
+		unitEvents:    map[string]chan sysd.UnitEvent{},
+		restarts:      newRestartTracker(""),
+		silences:      newSilencer(""),
 	}
 	dummyTestSpec.InitialDelaySeconds = spec.ToIntRef(2)
 	dummyTestSpec.Exec = &spec.ExecProbe{
@@ -100,3 +163,443 @@ func TestProberManager_ServiceHealthUnHealthy(t *testing.T) {
 	serviceHealth = pm.getServiceHealth(dummyTestSpec.ServiceName)
 	assert.Equal(t, ServiceHealth{probeResult: &ProbeResult{Status: status.Failure, Output: "wow", Error: dummyErr}, health: health.UnHealthy}, serviceHealth)
 }
+
+func newTestProberManager(prober Prober) *ProberManager {
+	return &ProberManager{
+		prober:        prober,
+		unitsManager:  &DummyUnits{},
+		serviceHealth: map[string]*ServiceHealth{},
+		probes:        map[string]chan int{},
+		unitEvents:    map[string]chan sysd.UnitEvent{},
+		restarts:      newRestartTracker(""),
+		silences:      newSilencer(""),
+	}
+}
+
+func TestProberManager_UnitFailedEvent(t *testing.T) {
+	pm := newTestProberManager(&ServiceProber{
+		exec: &MockExecProbe{status: status.Success, output: "wow", err: nil},
+	})
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "event-failed",
+		Probe: spec.Probe{
+			ProbeHandler:        spec.ProbeHandler{Exec: &spec.ExecProbe{Command: []string{"test"}}},
+			InitialDelaySeconds: spec.ToIntRef(0),
+			PeriodSeconds:       spec.ToIntRef(60),
+		},
+	}
+	assert.NoError(t, pm.Add(testSpec))
+	events := make(chan sysd.UnitEvent)
+	go pm.HandleUnitEvents(events)
+	events <- sysd.UnitEvent{Type: sysd.UnitChanged, Unit: "other", ActiveState: "failed"}
+	events <- sysd.UnitEvent{Type: sysd.UnitChanged, Unit: "event-failed", ActiveState: "failed", SubState: "failed"}
+	close(events)
+	time.Sleep(500 * time.Millisecond)
+	serviceHealth := pm.getServiceHealth(testSpec.ServiceName)
+	assert.Equal(t, health.UnHealthy, serviceHealth.health)
+	assert.Equal(t, "systemd reported the unit failed (failed)", serviceHealth.probeResult.Output)
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+}
+
+func TestProberManager_UnitStoppedEvent(t *testing.T) {
+	pm := newTestProberManager(&ServiceProber{
+		exec: &MockExecProbe{status: status.Success, output: "wow", err: nil},
+	})
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "event-stopped",
+		Probe: spec.Probe{
+			ProbeHandler:        spec.ProbeHandler{Exec: &spec.ExecProbe{Command: []string{"test"}}},
+			InitialDelaySeconds: spec.ToIntRef(0),
+			PeriodSeconds:       spec.ToIntRef(1),
+		},
+	}
+	assert.NoError(t, pm.Add(testSpec))
+	events := make(chan sysd.UnitEvent)
+	go pm.HandleUnitEvents(events)
+	defer close(events)
+
+	events <- sysd.UnitEvent{Type: sysd.UnitChanged, Unit: "event-stopped", ActiveState: "inactive", SubState: "dead"}
+	time.Sleep(2 * time.Second)
+	serviceHealth := pm.getServiceHealth(testSpec.ServiceName)
+	assert.Equal(t, health.UnHealthy, serviceHealth.health)
+	assert.Equal(t, "unit is inactive, probing paused", serviceHealth.probeResult.Output)
+
+	events <- sysd.UnitEvent{Type: sysd.UnitChanged, Unit: "event-stopped", ActiveState: "active", SubState: "running"}
+	time.Sleep(2 * time.Second)
+	serviceHealth = pm.getServiceHealth(testSpec.ServiceName)
+	assert.Equal(t, health.Healthy, serviceHealth.health)
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+}
+
+func TestProberManager_Warning(t *testing.T) {
+	limit := 512.0
+	tests := []struct {
+		name    string
+		handler spec.ProbeHandler
+		health  health.Health
+	}{
+		{
+			name:    "resources warning is healthy",
+			handler: spec.ProbeHandler{Resources: &spec.ResourcesProbe{RSSMegabytes: &spec.Threshold{Warning: &limit}}},
+			health:  health.Healthy,
+		},
+		{
+			name:    "tls expiry warning is healthy",
+			handler: spec.ProbeHandler{TLS: &spec.TLSProbe{Port: 443}},
+			health:  health.Healthy,
+		},
+		{
+			name:    "other warnings are failures",
+			handler: spec.ProbeHandler{Exec: &spec.ExecProbe{Command: []string{"test"}}},
+			health:  health.UnHealthy,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pm := newTestProberManager(&ServiceProber{
+				exec:      &MockExecProbe{status: status.Warning, output: "redirected", err: nil},
+				resources: &MockResourcesProbe{status: status.Warning, output: "approaching limit", err: nil},
+				tls:       &MockTlsProbe{status: status.Warning, output: "certificate expires in 13 days", err: nil},
+			})
+			testSpec := &spec.LivenessProbe{
+				ServiceName: "warning",
+				Probe: spec.Probe{
+					ProbeHandler:        test.handler,
+					InitialDelaySeconds: spec.ToIntRef(0),
+					PeriodSeconds:       spec.ToIntRef(1),
+					FailureThreshold:    spec.ToIntRef(1),
+					SuccessThreshold:    spec.ToIntRef(1),
+				},
+			}
+			assert.NoError(t, pm.Add(testSpec))
+			time.Sleep(1500 * time.Millisecond)
+			serviceHealth := pm.getServiceHealth(testSpec.ServiceName)
+			assert.Equal(t, test.health, serviceHealth.health)
+			assert.Equal(t, status.Warning, serviceHealth.probeResult.Status)
+			assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+		})
+	}
+}
+
+// activatingUnits reports every unit as activating since it was created.
+type activatingUnits struct {
+	since time.Time
+}
+
+func (au *activatingUnits) State(unitName string) (*sysd.UnitState, error) {
+	return &sysd.UnitState{ActiveState: "activating", SubState: "start", StateChangeTimestamp: au.since}, nil
+}
+
+func TestProberManager_UnitActivating(t *testing.T) {
+	units := &DummyUnits{}
+	pm := newTestProberManager(&ServiceProber{
+		unit: probe.NewUnitProbe(&activatingUnits{since: time.Now()}),
+	})
+	pm.unitsManager = units
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "activating.service",
+		AutoRestart: spec.ToBoolRef(true),
+		Probe: spec.Probe{
+			ProbeHandler:        spec.ProbeHandler{Unit: &spec.UnitProbe{MaxActivatingSeconds: spec.ToIntRef(60)}},
+			InitialDelaySeconds: spec.ToIntRef(0),
+			PeriodSeconds:       spec.ToIntRef(1),
+			FailureThreshold:    spec.ToIntRef(1),
+			SuccessThreshold:    spec.ToIntRef(1),
+		},
+	}
+	assert.NoError(t, pm.Add(testSpec))
+	time.Sleep(2500 * time.Millisecond)
+	serviceHealth := pm.getServiceHealth(testSpec.ServiceName)
+	assert.Equal(t, health.Healthy, serviceHealth.health, "activating within maxActivatingSeconds")
+	assert.Contains(t, serviceHealth.probeResult.Output, "ActiveState=activating")
+	assert.Empty(t, units.recorded(), "not remediated")
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+}
+
+// scriptedProber answers each probe with the statuses queued for its exec
+// command, repeating the last one, and counts the probes run.
+type scriptedProber struct {
+	mutex    sync.Mutex
+	statuses map[string][]status.Status
+	calls    map[string]int
+}
+
+func (sp *scriptedProber) probe(serviceName string, kind string, p *spec.Probe) *ProbeResult {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	name := p.Exec.Command[0]
+	statuses := sp.statuses[name]
+	s := statuses[min(sp.calls[name], len(statuses)-1)]
+	sp.calls[name]++
+	return NewProbeResult().WithStatus(s).WithOutput(name)
+}
+
+func (sp *scriptedProber) stop(serviceName string) {}
+
+func (sp *scriptedProber) callCount(name string) int {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return sp.calls[name]
+}
+
+func execProbe(command string, periodSeconds int, failureThreshold int) *spec.Probe {
+	return &spec.Probe{
+		ProbeHandler:        spec.ProbeHandler{Exec: &spec.ExecProbe{Command: []string{command}}},
+		InitialDelaySeconds: spec.ToIntRef(0),
+		PeriodSeconds:       spec.ToIntRef(periodSeconds),
+		FailureThreshold:    spec.ToIntRef(failureThreshold),
+	}
+}
+
+func TestProberManager_StartupProbeGatesLiveness(t *testing.T) {
+	prober := &scriptedProber{
+		statuses: map[string][]status.Status{
+			"startup":  {status.Failure, status.Failure, status.Success},
+			"liveness": {status.Success},
+		},
+		calls: map[string]int{},
+	}
+	pm := newTestProberManager(prober)
+	testSpec := &spec.LivenessProbe{
+		ServiceName:   "slow-start",
+		StartupProbe:  execProbe("startup", 1, 5),
+		LivenessProbe: execProbe("liveness", 1, 1),
+		AutoRestart:   spec.ToBoolRef(true),
+	}
+	assert.NoError(t, pm.Add(testSpec))
+	time.Sleep(2500 * time.Millisecond)
+	assert.Equal(t, 2, prober.callCount("startup"))
+	assert.Equal(t, 0, prober.callCount("liveness"))
+	assert.Equal(t, health.Unknown, pm.getServiceHealth(testSpec.ServiceName).health)
+
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 3, prober.callCount("startup"))
+	assert.Equal(t, 1, prober.callCount("liveness"))
+	assert.Equal(t, health.Healthy, pm.getServiceHealth(testSpec.ServiceName).health)
+	assert.Equal(t, int32(0), pm.unitsManager.(*DummyUnits).restarts.Load())
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+}
+
+func TestProberManager_ReadinessNeverRestarts(t *testing.T) {
+	prober := &scriptedProber{
+		statuses: map[string][]status.Status{
+			"liveness":  {status.Success},
+			"readiness": {status.Failure},
+		},
+		calls: map[string]int{},
+	}
+	pm := newTestProberManager(prober)
+	testSpec := &spec.LivenessProbe{
+		ServiceName:    "not-ready",
+		LivenessProbe:  execProbe("liveness", 1, 1),
+		ReadinessProbe: execProbe("readiness", 1, 1),
+		AutoRestart:    spec.ToBoolRef(true),
+	}
+	assert.NoError(t, pm.Add(testSpec))
+	time.Sleep(2500 * time.Millisecond)
+	serviceHealth := pm.getServiceHealth(testSpec.ServiceName)
+	assert.Equal(t, health.UnHealthy, serviceHealth.health)
+	assert.Equal(t, "readiness", serviceHealth.probeResult.Output)
+	assert.Equal(t, 2, prober.callCount("liveness"))
+	assert.Equal(t, int32(0), pm.unitsManager.(*DummyUnits).restarts.Load())
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+}
+
+func TestProberManager_StopDuringInitialDelay(t *testing.T) {
+	prober := &scriptedProber{
+		statuses: map[string][]status.Status{"liveness": {status.Success}},
+		calls:    map[string]int{},
+	}
+	pm := newTestProberManager(prober)
+	liveness := execProbe("liveness", 1, 1)
+	liveness.InitialDelaySeconds = spec.ToIntRef(60)
+	testSpec := &spec.LivenessProbe{ServiceName: "slow-start", LivenessProbe: liveness}
+	assert.NoError(t, pm.Add(testSpec))
+
+	start := time.Now()
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+	assert.Less(t, time.Since(start), time.Second, "stopping does not wait out the initial delay")
+	assert.Equal(t, 0, prober.callCount("liveness"))
+}
+
+func TestProberManager_LivenessFailureWithReadiness(t *testing.T) {
+	prober := &scriptedProber{
+		statuses: map[string][]status.Status{
+			"liveness":  {status.Failure},
+			"readiness": {status.Success},
+		},
+		calls: map[string]int{},
+	}
+	pm := newTestProberManager(prober)
+	testSpec := &spec.LivenessProbe{
+		ServiceName:    "deadlocked",
+		LivenessProbe:  execProbe("liveness", 1, 1),
+		ReadinessProbe: execProbe("readiness", 5, 1),
+		AutoRestart:    spec.ToBoolRef(true),
+	}
+	assert.NoError(t, pm.Add(testSpec))
+	time.Sleep(1500 * time.Millisecond)
+	serviceHealth := pm.getServiceHealth(testSpec.ServiceName)
+	assert.Equal(t, health.UnHealthy, serviceHealth.health, "a liveness failure is reported despite the readiness probe")
+	assert.Equal(t, "liveness", serviceHealth.probeResult.Output)
+	assert.Equal(t, int32(1), pm.unitsManager.(*DummyUnits).restarts.Load())
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+}
+
+func TestProberManager_StartupProbeFailureRestarts(t *testing.T) {
+	prober := &scriptedProber{
+		statuses: map[string][]status.Status{
+			"startup":  {status.Failure},
+			"liveness": {status.Success},
+		},
+		calls: map[string]int{},
+	}
+	pm := newTestProberManager(prober)
+	testSpec := &spec.LivenessProbe{
+		ServiceName:   "never-starts",
+		StartupProbe:  execProbe("startup", 1, 2),
+		LivenessProbe: execProbe("liveness", 1, 1),
+		AutoRestart:   spec.ToBoolRef(true),
+	}
+	assert.NoError(t, pm.Add(testSpec))
+	time.Sleep(2500 * time.Millisecond)
+	assert.Equal(t, health.UnHealthy, pm.getServiceHealth(testSpec.ServiceName).health)
+	assert.Equal(t, int32(1), pm.unitsManager.(*DummyUnits).restarts.Load())
+	assert.Equal(t, 0, prober.callCount("liveness"))
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+}
+
+func TestRecordProbeMetrics(t *testing.T) {
+	recordProbeMetrics("metrics.service", NewProbeResult().
+		WithMetrics(map[string]float64{"load1": 1.5}).
+		WithSubResults([]*ProbeResult{NewProbeResult().WithMetrics(map[string]float64{"queue": 7})}))
+	assert.Equal(t, 1.5, testutil.ToFloat64(probeMetrics.WithLabelValues("metrics.service", "load1")))
+	assert.Equal(t, 7.0, testutil.ToFloat64(probeMetrics.WithLabelValues("metrics.service", "queue")))
+}
+
+func TestProberManager_Remediation(t *testing.T) {
+	units := &DummyUnits{}
+	pm := newTestProberManager(nil)
+	pm.unitsManager = units
+	hookOutput := filepath.Join(t.TempDir(), "hook")
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "app.service",
+		Remediation: []*spec.RemediationAction{
+			{Action: "kill", Signal: "QUIT", Who: "main"},
+			{Action: "stop"},
+			{Action: "reset-failed"},
+			{Action: "start", Mode: "fail"},
+			{Action: "restart", Unit: "app-proxy.service"},
+			{Action: "exec", Command: []string{"sh", "-c", "echo $SPROBE_SERVICE_NAME > " + hookOutput}},
+		},
+	}
+	testSpec.Exec = &spec.ExecProbe{Command: []string{"true"}}
+	assert.NoError(t, testSpec.Validate())
+	pm.remediate(testSpec)
+	assert.Equal(t, []string{
+		"kill app.service main quit",
+		"stop app.service replace",
+		"reset-failed app.service",
+		"start app.service fail",
+		"restart app-proxy.service replace",
+	}, units.recorded())
+	data, err := os.ReadFile(hookOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, "app.service\n", string(data))
+
+	output, err := runRemediationHook("app.service", []string{"sh", "-c", "echo broken; exit 1"}, time.Second)
+	assert.Equal(t, "broken\n", output)
+	assert.ErrorContains(t, err, "sh did not exit with zero")
+}
+
+func TestProberManager_Escalation(t *testing.T) {
+	units := &DummyUnits{requires: []string{"db.service", "cache.service"}}
+	pm := newTestProberManager(nil)
+	pm.unitsManager = units
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "app.service",
+		Escalation: []*spec.EscalationStep{
+			{Actions: []*spec.RemediationAction{{Action: "reload"}}},
+			{Name: "dependencies", Actions: []*spec.RemediationAction{{Action: "restart-dependencies"}, {Action: "restart"}}},
+		},
+		RestartPolicy: &spec.RestartPolicy{BackoffSeconds: spec.ToIntRef(0)},
+	}
+	testSpec.Exec = &spec.ExecProbe{Command: []string{"true"}}
+	assert.NoError(t, testSpec.Validate())
+	assert.Equal(t, "reload", testSpec.Escalation[0].Name)
+
+	pm.remediate(testSpec)
+	assert.Equal(t, []string{"reload app.service replace"}, units.recorded())
+	pm.remediate(testSpec)
+	pm.remediate(testSpec)
+	assert.Equal(t, []string{
+		"reload app.service replace",
+		"restart db.service replace",
+		"restart cache.service replace",
+		"restart app.service replace",
+		"restart db.service replace",
+		"restart cache.service replace",
+		"restart app.service replace",
+	}, units.recorded(), "the last step repeats")
+
+	pm.restarts.recovered(testSpec.ServiceName)
+	pm.remediate(testSpec)
+	assert.Equal(t, "reload app.service replace", units.recorded()[7])
+}
+
+func TestProberManager_RestartDependencies(t *testing.T) {
+	units := &DummyUnits{requires: []string{
+		"system.slice", "db.service", "sysinit.target", "var-lib-app.mount", "app.socket", "-.mount", "cache.service",
+	}}
+	pm := newTestProberManager(nil)
+	pm.unitsManager = units
+
+	output, err := pm.runRemediationAction("app.service", &spec.RemediationAction{Action: "restart-dependencies", Unit: "app.service", Mode: "replace", TimeoutSeconds: spec.ToIntRef(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, "db.service: done, cache.service: done", output)
+	assert.Equal(t, []string{"restart db.service replace", "restart cache.service replace"}, units.recorded(),
+		"slices, targets, mounts and sockets are never restarted")
+
+	units = &DummyUnits{requires: []string{"system.slice", "sysinit.target"}}
+	pm.unitsManager = units
+	_, err = pm.runRemediationAction("app.service", &spec.RemediationAction{Action: "restart-dependencies", Unit: "app.service", Mode: "replace", TimeoutSeconds: spec.ToIntRef(1)})
+	assert.ErrorContains(t, err, "app.service requires no services")
+	assert.Empty(t, units.recorded())
+
+	_, err = pm.runRemediationAction("app.service", &spec.RemediationAction{Action: "restart-dependencies", Unit: "app.service", Mode: "replace", TimeoutSeconds: spec.ToIntRef(1), Dependencies: []string{"queue.service"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"restart queue.service replace"}, units.recorded(), "configured dependencies replace Requires=")
+}
+
+func TestProberManager_RemediationVerification(t *testing.T) {
+	units := &DummyUnits{activeState: "failed"}
+	pm := newTestProberManager(nil)
+	pm.unitsManager = units
+	testSpec := &spec.LivenessProbe{ServiceName: "crashing.service", AutoRestart: spec.ToBoolRef(true)}
+	testSpec.Exec = &spec.ExecProbe{Command: []string{"true"}}
+	assert.NoError(t, testSpec.Validate())
+	// the counters are global, so only what this test added is compared
+	successes := testutil.ToFloat64(remediationResultMetrics.WithLabelValues("crashing.service", "success"))
+	failures := testutil.ToFloat64(remediationResultMetrics.WithLabelValues("crashing.service", "failure"))
+	pm.remediate(testSpec)
+	assert.Equal(t, failures+1, testutil.ToFloat64(remediationResultMetrics.WithLabelValues("crashing.service", "failure")),
+		"a unit that is failed after the restart fails the remediation right away")
+
+	units.activeState = ""
+	pm.restarts.now = func() time.Time { return time.Now().Add(time.Hour) }
+	pm.remediate(testSpec)
+	pm.restarts.recovered(testSpec.ServiceName)
+	assert.Equal(t, successes+1, testutil.ToFloat64(remediationResultMetrics.WithLabelValues("crashing.service", "success")))
+	assert.Equal(t, failures+1, testutil.ToFloat64(remediationResultMetrics.WithLabelValues("crashing.service", "failure")))
+}
+
+func TestProberManager_StopReleasesJournal(t *testing.T) {
+	journal := &MockJournalProbe{status: status.Success}
+	pm := newTestProberManager(&ServiceProber{journal: journal})
+	testSpec := &spec.LivenessProbe{ServiceName: "journal.service"}
+	testSpec.Journal = &spec.JournalProbe{Patterns: []string{"panic:"}}
+	testSpec.InitialDelaySeconds = spec.ToIntRef(0)
+	assert.NoError(t, pm.Add(testSpec))
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+	assert.Equal(t, []string{"journal.service"}, journal.stopped)
+}
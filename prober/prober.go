@@ -2,20 +2,36 @@ package prober
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
-	"net/http"
-	"os/exec"
 	"github.com/glendsoza/sprobe/spec"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/glendsoza/sprobe/probe"
 	"github.com/glendsoza/sprobe/status"
+	"github.com/glendsoza/sprobe/sysd"
 )
 
 type ProbeResult struct {
-	Status status.Status
-	Output string
-	Error  error
+	// Name identifies the check a sub result belongs to
+	Name       string
+	Status     status.Status
+	Output     string
+	Error      error
+	SubResults []*ProbeResult
+	// Metrics are values reported by the probe itself, e.g. the performance
+	// data of a Nagios plugin
+	Metrics map[string]float64
 }
 
 func NewProbeResult() *ProbeResult {
@@ -41,37 +57,184 @@ func (pr *ProbeResult) WithError(err error) *ProbeResult {
 	return pr
 }
 
+func (pr *ProbeResult) WithName(name string) *ProbeResult {
+	pr.Name = name
+	return pr
+}
+
+func (pr *ProbeResult) WithSubResults(subResults []*ProbeResult) *ProbeResult {
+	pr.SubResults = subResults
+	return pr
+}
+
+func (pr *ProbeResult) WithMetrics(metrics map[string]float64) *ProbeResult {
+	pr.Metrics = metrics
+	return pr
+}
+
 type Prober interface {
-	probe(spec *spec.LivenessProbe) *ProbeResult
+	// probe runs p, the startup, liveness or readiness probe named by kind
+	probe(serviceName string, kind string, p *spec.Probe) *ProbeResult
+	// stop releases what probing serviceName kept running in the background
+	stop(serviceName string)
 }
 
 type ServiceProber struct {
-	exec probe.ExecProbe
-	http probe.HttpProbe
-	tcp  probe.TcpProbe
+	exec      probe.ExecProbe
+	http      probe.HttpProbe
+	tcp       probe.TcpProbe
+	grpc      probe.GrpcProbe
+	tls       probe.TlsProbe
+	unit      probe.UnitProbe
+	resources probe.ResourcesProbe
+	journal   probe.JournalProbe
+	dns       probe.DnsProbe
+	udp       probe.UdpProbe
+	sql       probe.SqlProbe
+	redis     probe.RedisProbe
+	websocket probe.WebsocketProbe
+	file      probe.FileProbe
 }
 
-func NewServiceProber() Prober {
+func NewServiceProber(units sysd.Units) Prober {
 	return &ServiceProber{
-		exec: probe.NewExecProbe(),
-		http: probe.NewHttpProbe(true),
-		tcp:  probe.NewTcpProbe()}
+		exec:      probe.NewExecProbe(),
+		http:      probe.NewHttpProbe(true),
+		tcp:       probe.NewTcpProbe(),
+		grpc:      probe.NewGrpcProbe(),
+		tls:       probe.NewTlsProbe(),
+		unit:      probe.NewUnitProbe(units),
+		resources: probe.NewResourcesProbe(units),
+		journal:   probe.NewJournalProbe(probe.NewJournalctlFollower()),
+		dns:       probe.NewDnsProbe(),
+		udp:       probe.NewUdpProbe(),
+		sql:       probe.NewSqlProbe(),
+		redis:     probe.NewRedisProbe(),
+		websocket: probe.NewWebsocketProbe(),
+		file:      probe.NewFileProbe()}
 }
 
-func (p *ServiceProber) probe(spec *spec.LivenessProbe) *ProbeResult {
+func (p *ServiceProber) stop(serviceName string) {
+	if p.journal != nil {
+		p.journal.Stop(serviceName)
+	}
+	if p.resources != nil {
+		p.resources.Stop(serviceName)
+	}
+}
+
+func (p *ServiceProber) probe(serviceName string, kind string, spec *spec.Probe) *ProbeResult {
 	timeOutDuration := time.Duration(*spec.TimeoutSeconds) * time.Second
+	if len(spec.Checks) > 0 {
+		return p.probeChecks(serviceName, kind, spec, timeOutDuration)
+	}
+	return p.probeHandler(serviceName, kind, &spec.ProbeHandler, timeOutDuration)
+}
+
+// probeChecks runs all checks concurrently and passes when at least the
+// required number of them did. A check passes on a warning only when its probe
+// type would on its own. A passing composite with failing or warning checks is
+// reported as a Warning so the degradation stays visible.
+func (p *ServiceProber) probeChecks(serviceName string, kind string, spec *spec.Probe, timeOutDuration time.Duration) *ProbeResult {
+	results := make([]*ProbeResult, len(spec.Checks))
+	var wg sync.WaitGroup
+	for i, check := range spec.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = p.probeHandler(serviceName, kind+"/"+check.Name, &check.ProbeHandler, timeOutDuration).
+				WithName(check.Name)
+		}()
+	}
+	wg.Wait()
+
+	passed := 0
+	degraded := false
+	var failed []string
+	for i, r := range results {
+		if r.Status == status.Success || (r.Status == status.Warning && handlerToleratesWarning(&spec.Checks[i].ProbeHandler)) {
+			passed++
+		}
+		if r.Status != status.Success {
+			degraded = true
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Name, r.Status))
+		}
+	}
+	required := spec.RequiredChecks()
+	output := fmt.Sprintf("%d of %d checks passed, %d required", passed, len(results), required)
+	if len(failed) > 0 {
+		output += " (" + strings.Join(failed, ", ") + ")"
+	}
+	probeStatus := status.Success
+	switch {
+	case passed < required:
+		probeStatus = status.Failure
+	case degraded:
+		probeStatus = status.Warning
+	}
+	return NewProbeResult().
+		WithStatus(probeStatus).
+		WithOutput(output).
+		WithSubResults(results)
+}
+
+// probeHandler runs one probe type. probeName tells the probes of a service
+// apart, e.g. "liveness" or "readiness/resources#2" for a check.
+func (p *ServiceProber) probeHandler(serviceName string, probeName string, spec *spec.ProbeHandler, timeOutDuration time.Duration) *ProbeResult {
 	switch {
 	case spec.Exec != nil:
-		var cmd *exec.Cmd
+		opts := probe.ExecOptions{
+			WorkingDir: spec.Exec.WorkingDir,
+			User:       spec.Exec.User,
+			Group:      spec.Exec.Group,
+		}
+		if spec.Exec.EnvFile != "" {
+			env, err := probe.ReadEnvFile(spec.Exec.EnvFile)
+			if err != nil {
+				return NewProbeResult().
+					WithStatus(status.Unknown).
+					WithOutput("").
+					WithError(err)
+			}
+			opts.Env = env
+		}
+		for _, env := range spec.Exec.Env {
+			opts.Env = append(opts.Env, env.Name+"="+env.Value)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), timeOutDuration)
 		defer cancel()
-		if len(spec.Exec.Command) == 1 {
-			cmd = exec.CommandContext(ctx, spec.Exec.Command[0])
-		} else {
-			cmd = exec.CommandContext(ctx, spec.Exec.Command[0], spec.Exec.Command[1:]...)
+		cmd, err := probe.NewCmd(ctx, spec.Exec.Command, opts)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
 		}
 
-		probeStatus, output, err := p.exec.Probe(&probe.Cmd{Cmd: cmd})
+		switch spec.Exec.Output {
+		case "json":
+			probeStatus, output, metrics, err := p.exec.ProbeJSON(cmd, *spec.Exec.MaxOutputBytes)
+			return NewProbeResult().
+				WithStatus(probeStatus).
+				WithOutput(output).
+				WithError(err).
+				WithMetrics(metrics)
+		case "nagios":
+			probeStatus, output, perfData, err := p.exec.ProbeNagios(cmd, *spec.Exec.MaxOutputBytes)
+			var metrics map[string]float64
+			for _, pd := range perfData {
+				if metrics == nil {
+					metrics = map[string]float64{}
+				}
+				metrics[pd.Label] = pd.Value
+			}
+			return NewProbeResult().
+				WithStatus(probeStatus).
+				WithOutput(output).
+				WithError(err).
+				WithMetrics(metrics)
+		}
+		probeStatus, output, err := p.exec.Probe(cmd, *spec.Exec.MaxOutputBytes)
 		return NewProbeResult().
 			WithStatus(probeStatus).
 			WithOutput(output).
@@ -88,14 +251,254 @@ func (p *ServiceProber) probe(spec *spec.LivenessProbe) *ProbeResult {
 		for _, header := range spec.HTTPGet.HTTPHeaders {
 			req.Header.Set(header.Name, header.Value)
 		}
+		if spec.HTTPGet.SocketPath != "" {
+			req = probe.WithSocketPath(req, spec.HTTPGet.SocketPath)
+		}
 		probeStatus, output, err := p.http.Probe(req, timeOutDuration)
 		return NewProbeResult().
 			WithStatus(probeStatus).
 			WithOutput(output).
 			WithError(err)
 
+	case spec.HTTP != nil:
+		var body io.Reader
+		if spec.HTTP.Body != "" {
+			body = strings.NewReader(spec.HTTP.Body)
+		}
+		req, err := http.NewRequest(spec.HTTP.Method, spec.HTTP.URL, body)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		for _, header := range spec.HTTP.HTTPHeaders {
+			req.Header.Set(header.Name, header.Value)
+		}
+		if spec.HTTP.SocketPath != "" {
+			req = probe.WithSocketPath(req, spec.HTTP.SocketPath)
+		}
+		expect := httpExpectations(spec.HTTP)
+		probeStatus, output, err := p.http.ProbeWithExpectations(req, timeOutDuration, expect)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
 	case spec.TCPSocket != nil:
-		probeStatus, output, err := p.tcp.Probe("localhost", spec.TCPSocket.Port, timeOutDuration)
+		steps, err := tcpSteps(spec.TCPSocket.Steps)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		network, addr := spec.TCPSocket.Network()
+		probeStatus, output, err := p.tcp.Probe(network, addr, steps, timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.GRPC != nil:
+		tlsConfig, err := tlsClientConfig(spec.GRPC.TLS)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		md := make(map[string]string, len(spec.GRPC.Metadata))
+		for _, m := range spec.GRPC.Metadata {
+			md[m.Name] = m.Value
+		}
+		addr := net.JoinHostPort(spec.GRPC.Host, strconv.Itoa(spec.GRPC.Port))
+		probeStatus, output, err := p.grpc.Probe(addr, spec.GRPC.Service, md, tlsConfig, timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.TLS != nil:
+		var roots *x509.CertPool
+		if spec.TLS.CAFile != "" {
+			var err error
+			roots, err = loadCertPool(spec.TLS.CAFile)
+			if err != nil {
+				return NewProbeResult().
+					WithStatus(status.Unknown).
+					WithOutput("").
+					WithError(err)
+			}
+		}
+		addr := net.JoinHostPort(spec.TLS.Host, strconv.Itoa(spec.TLS.Port))
+		warnWithin := time.Duration(*spec.TLS.ExpiryWarningDays) * 24 * time.Hour
+		probeStatus, output, err := p.tls.Probe(addr, spec.TLS.ServerName, roots, warnWithin, timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.Unit != nil:
+		probeStatus, output, err := p.unit.Probe(serviceName,
+			time.Duration(*spec.Unit.MaxActivatingSeconds)*time.Second,
+			spec.Unit.MaxRestarts,
+			time.Duration(*spec.Unit.RestartWindowSeconds)*time.Second)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.Resources != nil:
+		probeStatus, output, err := p.resources.Probe(serviceName, probeName, resourceLimits(spec.Resources))
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.Journal != nil:
+		patterns := make([]*regexp.Regexp, 0, len(spec.Journal.Patterns))
+		for _, expr := range spec.Journal.Patterns {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return NewProbeResult().
+					WithStatus(status.Unknown).
+					WithOutput("").
+					WithError(err)
+			}
+			patterns = append(patterns, re)
+		}
+		probeStatus, output, err := p.journal.Probe(serviceName, patterns, spec.Journal.MaxMatches,
+			time.Duration(*spec.Journal.WindowSeconds)*time.Second)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.DNS != nil:
+		expect := probe.DNSExpectations{
+			Rcode:         spec.DNS.ResponseCode(),
+			RequireAnswer: *spec.DNS.ExpectAnswer,
+			Values:        spec.DNS.ExpectedValues,
+			MaxLatency:    time.Duration(spec.DNS.MaxLatencyMilliseconds) * time.Millisecond,
+		}
+		probeStatus, output, err := p.dns.Probe(spec.DNS.Server, spec.DNS.Protocol, spec.DNS.Name, spec.DNS.QueryType(), expect, timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.UDP != nil:
+		exchange, err := udpExchange(spec.UDP)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		network, addr := spec.UDP.Network()
+		probeStatus, output, err := p.udp.Probe(network, addr, exchange, timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.Postgres != nil:
+		password, err := readPassword(spec.Postgres.Password, spec.Postgres.PasswordFile)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		dsn := probe.PostgresDSN(spec.Postgres.Host, spec.Postgres.Port, spec.Postgres.User, password,
+			spec.Postgres.Database, spec.Postgres.SSLMode, timeOutDuration)
+		probeStatus, output, err := p.sql.Probe("postgres", dsn, "SELECT 1", timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.MySQL != nil:
+		password, err := readPassword(spec.MySQL.Password, spec.MySQL.PasswordFile)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		dsn := probe.MySQLDSN(spec.MySQL.Host, spec.MySQL.Port, spec.MySQL.SocketPath, spec.MySQL.User, password,
+			spec.MySQL.Database, timeOutDuration)
+		probeStatus, output, err := p.sql.Probe("mysql", dsn, "", timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.Redis != nil:
+		password, err := readPassword(spec.Redis.Password, spec.Redis.PasswordFile)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		network, addr := spec.Redis.Network()
+		probeStatus, output, err := p.redis.Probe(network, addr, spec.Redis.Username, password,
+			spec.Redis.ExpectedRole, timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.WebSocket != nil:
+		tlsConfig, err := tlsClientConfig(spec.WebSocket.TLS)
+		if err != nil {
+			return NewProbeResult().
+				WithStatus(status.Unknown).
+				WithOutput("").
+				WithError(err)
+		}
+		header := http.Header{}
+		for _, h := range spec.WebSocket.HTTPHeaders {
+			header.Add(h.Name, h.Value)
+		}
+		exchange := probe.WebSocketExchange{Send: []byte(spec.WebSocket.Send)}
+		if spec.WebSocket.Expect != "" {
+			exchange.Expect = []byte(spec.WebSocket.Expect)
+		}
+		if spec.WebSocket.ExpectRegex != "" {
+			exchange.ExpectRegex, err = regexp.Compile(spec.WebSocket.ExpectRegex)
+			if err != nil {
+				return NewProbeResult().
+					WithStatus(status.Unknown).
+					WithOutput("").
+					WithError(err)
+			}
+		}
+		probeStatus, output, err := p.websocket.Probe(spec.WebSocket.URL, header, tlsConfig, exchange, timeOutDuration)
+		return NewProbeResult().
+			WithStatus(probeStatus).
+			WithOutput(output).
+			WithError(err)
+
+	case spec.File != nil:
+		expect := probe.FileExpectations{
+			MaxAge:  time.Duration(spec.File.MaxAgeSeconds) * time.Second,
+			MinSize: spec.File.MinSizeBytes,
+			MaxSize: spec.File.MaxSizeBytes,
+		}
+		if spec.File.ContentRegex != "" {
+			re, err := regexp.Compile(spec.File.ContentRegex)
+			if err != nil {
+				return NewProbeResult().
+					WithStatus(status.Unknown).
+					WithOutput("").
+					WithError(err)
+			}
+			expect.ContentRegex = re
+		}
+		probeStatus, output, err := p.file.Probe(spec.File.Path, expect)
 		return NewProbeResult().
 			WithStatus(probeStatus).
 			WithOutput(output).
@@ -106,3 +509,137 @@ func (p *ServiceProber) probe(spec *spec.LivenessProbe) *ProbeResult {
 		WithOutput("").
 		WithError(fmt.Errorf("unable to determine the prober from the spec"))
 }
+
+func tlsClientConfig(cfg *spec.TLSClientConfig) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+func httpExpectations(hp *spec.HTTPProbe) *probe.HTTPExpectations {
+	expect := &probe.HTTPExpectations{BodyContains: hp.BodyContains, BodyMatches: hp.BodyRegexps()}
+	for _, r := range hp.StatusCodes() {
+		expect.StatusCodes = append(expect.StatusCodes, probe.StatusCodeRange(r))
+	}
+	for _, jp := range hp.JSONPath {
+		expect.JSONPaths = append(expect.JSONPaths, probe.JSONPathAssertion{Path: jp.Path, Value: jp.Value})
+	}
+	for _, h := range hp.ResponseHeaders {
+		expect.Headers = append(expect.Headers, probe.HeaderAssertion{Name: h.Name, Value: h.Value})
+	}
+	return expect
+}
+
+func tcpSteps(specSteps []spec.TCPStep) ([]probe.TCPStep, error) {
+	steps := make([]probe.TCPStep, 0, len(specSteps))
+	for _, s := range specSteps {
+		step := probe.TCPStep{Send: []byte(s.Send)}
+		if s.SendHex != "" {
+			b, err := hex.DecodeString(s.SendHex)
+			if err != nil {
+				return nil, err
+			}
+			step.Send = b
+		}
+		if s.Expect != "" {
+			step.Expect = []byte(s.Expect)
+		}
+		if s.ExpectRegex != "" {
+			re, err := regexp.Compile(s.ExpectRegex)
+			if err != nil {
+				return nil, err
+			}
+			step.ExpectRegex = re
+		}
+		if s.TimeoutSeconds != nil {
+			step.Timeout = time.Duration(*s.TimeoutSeconds) * time.Second
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func udpExchange(up *spec.UDPProbe) (probe.UDPExchange, error) {
+	exchange := probe.UDPExchange{Send: []byte(up.Send)}
+	if up.SendHex != "" {
+		b, err := hex.DecodeString(up.SendHex)
+		if err != nil {
+			return exchange, err
+		}
+		exchange.Send = b
+	}
+	if up.Expect != "" {
+		exchange.Expect = []byte(up.Expect)
+	}
+	if up.ExpectRegex != "" {
+		re, err := regexp.Compile(up.ExpectRegex)
+		if err != nil {
+			return exchange, err
+		}
+		exchange.ExpectRegex = re
+	}
+	return exchange, nil
+}
+
+// readPassword returns password, or the contents of passwordFile without the
+// trailing newline. The file is read on every probe so rotated credentials are
+// picked up without a restart.
+func readPassword(password string, passwordFile string) (string, error) {
+	if passwordFile == "" {
+		return password, nil
+	}
+	b, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func resourceLimits(rp *spec.ResourcesProbe) probe.ResourceLimits {
+	threshold := func(t *spec.Threshold, scale float64) probe.Threshold {
+		var pt probe.Threshold
+		if t == nil {
+			return pt
+		}
+		if t.Warning != nil {
+			w := *t.Warning * scale
+			pt.Warning = &w
+		}
+		if t.Failure != nil {
+			f := *t.Failure * scale
+			pt.Failure = &f
+		}
+		return pt
+	}
+	return probe.ResourceLimits{
+		RSSBytes:       threshold(rp.RSSMegabytes, 1024*1024),
+		CPUPercent:     threshold(rp.CPUPercent, 1),
+		OpenFiles:      threshold(rp.OpenFiles, 1),
+		Threads:        threshold(rp.Threads, 1),
+		MemoryPressure: threshold(rp.MemoryPressure, 1),
+	}
+}
@@ -1,15 +1,21 @@
 package prober
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"net/http"
 	"github.com/glendsoza/sprobe/status"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 	"time"
 
 	"github.com/glendsoza/sprobe/probe"
 	"github.com/glendsoza/sprobe/spec"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 type MockUnitsManager struct {
@@ -49,45 +55,259 @@ func TestProberResult(t *testing.T) {
 }
 
 type MockExecProbe struct {
-	status status.Status
-	output string
-	err    error
+	status      status.Status
+	output      string
+	err         error
+	perfData    []probe.PerfData
+	metrics     map[string]float64
+	cmd         probe.CmdWrapper
+	outputLimit int
 }
 
-func (me *MockExecProbe) Probe(e probe.CmdWrapper) (status.Status, string, error) {
+func (me *MockExecProbe) Probe(e probe.CmdWrapper, outputLimit int) (status.Status, string, error) {
+	me.cmd = e
+	me.outputLimit = outputLimit
 	return me.status, me.output, me.err
 }
 
+func (me *MockExecProbe) ProbeJSON(e probe.CmdWrapper, outputLimit int) (status.Status, string, map[string]float64, error) {
+	me.cmd = e
+	me.outputLimit = outputLimit
+	return me.status, me.output, me.metrics, me.err
+}
+
+func (me *MockExecProbe) ProbeNagios(e probe.CmdWrapper, outputLimit int) (status.Status, string, []probe.PerfData, error) {
+	me.cmd = e
+	me.outputLimit = outputLimit
+	return me.status, me.output, me.perfData, me.err
+}
+
 type MockHttpProbe struct {
 	status status.Status
 	output string
 	err    error
+	req    *http.Request
+	expect *probe.HTTPExpectations
 }
 
 func (mh *MockHttpProbe) Probe(req *http.Request, timeout time.Duration) (status.Status, string, error) {
 	return mh.status, mh.output, mh.err
 }
 
+func (mh *MockHttpProbe) ProbeWithExpectations(req *http.Request, timeout time.Duration, expect *probe.HTTPExpectations) (status.Status, string, error) {
+	mh.req = req
+	mh.expect = expect
+	return mh.status, mh.output, mh.err
+}
+
 type MockTcpProbe struct {
+	status  status.Status
+	output  string
+	err     error
+	network string
+	addr    string
+	steps   []probe.TCPStep
+}
+
+func (mt *MockTcpProbe) Probe(network string, addr string, steps []probe.TCPStep, timeout time.Duration) (status.Status, string, error) {
+	mt.network = network
+	mt.addr = addr
+	mt.steps = steps
+	return mt.status, mt.output, mt.err
+}
+
+type MockGrpcProbe struct {
 	status status.Status
 	output string
 	err    error
 }
 
-func (mt *MockTcpProbe) Probe(host string, port int, timeout time.Duration) (status.Status, string, error) {
+func (mg *MockGrpcProbe) Probe(addr string, service string, md map[string]string, tlsConfig *tls.Config, timeout time.Duration) (status.Status, string, error) {
+	return mg.status, mg.output, mg.err
+}
+
+type MockTlsProbe struct {
+	status     status.Status
+	output     string
+	err        error
+	serverName string
+	warnWithin time.Duration
+}
+
+func (mt *MockTlsProbe) Probe(addr string, serverName string, roots *x509.CertPool, warnWithin time.Duration, timeout time.Duration) (status.Status, string, error) {
+	mt.serverName = serverName
+	mt.warnWithin = warnWithin
 	return mt.status, mt.output, mt.err
 }
 
+type MockUnitProbe struct {
+	status        status.Status
+	output        string
+	err           error
+	unitName      string
+	maxActivating time.Duration
+	maxRestarts   int
+	restartWindow time.Duration
+}
+
+func (mu *MockUnitProbe) Probe(unitName string, maxActivating time.Duration, maxRestarts int, restartWindow time.Duration) (status.Status, string, error) {
+	mu.unitName = unitName
+	mu.maxActivating = maxActivating
+	mu.maxRestarts = maxRestarts
+	mu.restartWindow = restartWindow
+	return mu.status, mu.output, mu.err
+}
+
+type MockResourcesProbe struct {
+	status status.Status
+	output string
+	err    error
+	limits probe.ResourceLimits
+}
+
+func (mr *MockResourcesProbe) Probe(unitName string, probeName string, limits probe.ResourceLimits) (status.Status, string, error) {
+	mr.limits = limits
+	return mr.status, mr.output, mr.err
+}
+
+func (mr *MockResourcesProbe) Stop(unitName string) {}
+
+type MockJournalProbe struct {
+	status     status.Status
+	output     string
+	err        error
+	patterns   []*regexp.Regexp
+	maxMatches int
+	window     time.Duration
+	stopped    []string
+}
+
+func (mj *MockJournalProbe) Probe(unitName string, patterns []*regexp.Regexp, maxMatches int, window time.Duration) (status.Status, string, error) {
+	mj.patterns = patterns
+	mj.maxMatches = maxMatches
+	mj.window = window
+	return mj.status, mj.output, mj.err
+}
+
+func (mj *MockJournalProbe) Stop(unitName string) {
+	mj.stopped = append(mj.stopped, unitName)
+}
+
+type MockDnsProbe struct {
+	status  status.Status
+	output  string
+	err     error
+	server  string
+	network string
+	name    string
+	qtype   dnsmessage.Type
+	expect  probe.DNSExpectations
+}
+
+func (md *MockDnsProbe) Probe(server string, network string, name string, qtype dnsmessage.Type, expect probe.DNSExpectations, timeout time.Duration) (status.Status, string, error) {
+	md.server = server
+	md.network = network
+	md.name = name
+	md.qtype = qtype
+	md.expect = expect
+	return md.status, md.output, md.err
+}
+
+type MockUdpProbe struct {
+	status   status.Status
+	output   string
+	err      error
+	network  string
+	addr     string
+	exchange probe.UDPExchange
+}
+
+func (mu *MockUdpProbe) Probe(network string, addr string, exchange probe.UDPExchange, timeout time.Duration) (status.Status, string, error) {
+	mu.network = network
+	mu.addr = addr
+	mu.exchange = exchange
+	return mu.status, mu.output, mu.err
+}
+
+type MockSqlProbe struct {
+	status     status.Status
+	output     string
+	err        error
+	driverName string
+	dsn        string
+	query      string
+}
+
+func (ms *MockSqlProbe) Probe(driverName string, dsn string, query string, timeout time.Duration) (status.Status, string, error) {
+	ms.driverName = driverName
+	ms.dsn = dsn
+	ms.query = query
+	return ms.status, ms.output, ms.err
+}
+
+type MockRedisProbe struct {
+	status       status.Status
+	output       string
+	err          error
+	network      string
+	addr         string
+	password     string
+	expectedRole string
+}
+
+func (mr *MockRedisProbe) Probe(network string, addr string, username string, password string, expectedRole string, timeout time.Duration) (status.Status, string, error) {
+	mr.network = network
+	mr.addr = addr
+	mr.password = password
+	mr.expectedRole = expectedRole
+	return mr.status, mr.output, mr.err
+}
+
+type MockWebsocketProbe struct {
+	status    status.Status
+	output    string
+	err       error
+	url       string
+	header    http.Header
+	tlsConfig *tls.Config
+	exchange  probe.WebSocketExchange
+}
+
+func (mw *MockWebsocketProbe) Probe(url string, header http.Header, tlsConfig *tls.Config, exchange probe.WebSocketExchange, timeout time.Duration) (status.Status, string, error) {
+	mw.url = url
+	mw.header = header
+	mw.tlsConfig = tlsConfig
+	mw.exchange = exchange
+	return mw.status, mw.output, mw.err
+}
+
+type MockFileProbe struct {
+	status status.Status
+	output string
+	err    error
+	path   string
+	expect probe.FileExpectations
+}
+
+func (mf *MockFileProbe) Probe(path string, expect probe.FileExpectations) (status.Status, string, error) {
+	mf.path = path
+	mf.expect = expect
+	return mf.status, mf.output, mf.err
+}
+
 func TestProberExec(t *testing.T) {
 	testSpec := &spec.LivenessProbe{
-		InitialDelaySeconds: spec.ToIntRef(10),
-		PeriodSeconds:       spec.ToIntRef(10),
-		TimeoutSeconds:      spec.ToIntRef(10),
-		FailureThreshold:    spec.ToIntRef(10),
-		SuccessThreshold:    spec.ToIntRef(10),
+		Probe: spec.Probe{
+			InitialDelaySeconds: spec.ToIntRef(10),
+			PeriodSeconds:       spec.ToIntRef(10),
+			TimeoutSeconds:      spec.ToIntRef(10),
+			FailureThreshold:    spec.ToIntRef(10),
+			SuccessThreshold:    spec.ToIntRef(10),
+		},
 	}
 	testSpec.Exec = &spec.ExecProbe{
-		Command: []string{"test"},
+		Command:        []string{"test"},
+		MaxOutputBytes: spec.ToIntRef(spec.DefaultExecOutputLimit),
 	}
 	testCases := []struct {
 		name   string
@@ -106,7 +326,7 @@ func TestProberExec(t *testing.T) {
 				err:    tc.error,
 			}
 			prober := ServiceProber{exec: mockExecProbe}
-			r := prober.probe(testSpec)
+			r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
 			assert.Equal(tt, &ProbeResult{
 				Status: tc.status,
 				Output: tc.output,
@@ -116,13 +336,95 @@ func TestProberExec(t *testing.T) {
 	}
 }
 
+func TestProberExecOptions(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	assert.NoError(t, os.WriteFile(envFile, []byte("FROM_FILE=1\nOVERRIDDEN=file\n"), 0600))
+	testSpec := &spec.LivenessProbe{ServiceName: "test.service"}
+	testSpec.Exec = &spec.ExecProbe{
+		Command:    []string{"test", "arg"},
+		Env:        []spec.EnvVar{{Name: "OVERRIDDEN", Value: "env"}},
+		EnvFile:    envFile,
+		WorkingDir: dir,
+	}
+	assert.NoError(t, testSpec.Validate())
+	assert.Equal(t, spec.DefaultExecOutputLimit, *testSpec.Exec.MaxOutputBytes)
+
+	mockExecProbe := &MockExecProbe{status: status.Success}
+	prober := ServiceProber{exec: mockExecProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", testSpec.LivenessProbe)
+	assert.Equal(t, status.Success, r.Status)
+	assert.Equal(t, spec.DefaultExecOutputLimit, mockExecProbe.outputLimit)
+	cmd := mockExecProbe.cmd.(*probe.Cmd)
+	assert.Equal(t, []string{"test", "arg"}, cmd.Args)
+	assert.Equal(t, dir, cmd.Dir)
+	assert.Equal(t, []string{"FROM_FILE=1", "OVERRIDDEN=file", "OVERRIDDEN=env"}, cmd.Env[len(cmd.Env)-3:])
+
+	assert.NoError(t, os.Remove(envFile))
+	r = prober.probe(testSpec.ServiceName, "liveness", testSpec.LivenessProbe)
+	assert.Equal(t, status.Unknown, r.Status)
+	assert.Error(t, r.Error)
+
+	testSpec.Exec.Command = nil
+	assert.ErrorContains(t, testSpec.Validate(), "must define a command")
+	testSpec.Exec = &spec.ExecProbe{Command: []string{"test"}, Env: []spec.EnvVar{{Name: "A=B"}}}
+	assert.ErrorContains(t, testSpec.Validate(), "invalid exec env name")
+}
+
+func TestProberExecNagios(t *testing.T) {
+	testSpec := &spec.LivenessProbe{ServiceName: "test.service"}
+	testSpec.Exec = &spec.ExecProbe{
+		Command: []string{"check_load"},
+		Output:  "nagios",
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockExecProbe := &MockExecProbe{
+		status:   status.Warning,
+		output:   "WARNING - load average: 5.0",
+		perfData: []probe.PerfData{{Label: "load1", Value: 5}, {Label: "load5", Value: 2.5}},
+	}
+	prober := ServiceProber{exec: mockExecProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", testSpec.LivenessProbe)
+	assert.Equal(t, &ProbeResult{
+		Status:  status.Warning,
+		Output:  "WARNING - load average: 5.0",
+		Metrics: map[string]float64{"load1": 5, "load5": 2.5},
+	}, r)
+
+	testSpec.Exec.Output = "xml"
+	assert.ErrorContains(t, testSpec.Validate(), "unsupported exec output")
+}
+
+func TestProberExecJSON(t *testing.T) {
+	testSpec := &spec.LivenessProbe{ServiceName: "test.service"}
+	testSpec.Exec = &spec.ExecProbe{
+		Command: []string{"health.py"},
+		Output:  "json",
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockExecProbe := &MockExecProbe{
+		status:  status.Warning,
+		output:  "queue is backing up",
+		metrics: map[string]float64{"queue": 42},
+	}
+	prober := ServiceProber{exec: mockExecProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", testSpec.LivenessProbe)
+	assert.Equal(t, &ProbeResult{
+		Status:  status.Warning,
+		Output:  "queue is backing up",
+		Metrics: map[string]float64{"queue": 42},
+	}, r)
+}
+
 func TestProberTcp(t *testing.T) {
 	testSpec := &spec.LivenessProbe{
-		InitialDelaySeconds: spec.ToIntRef(10),
-		PeriodSeconds:       spec.ToIntRef(10),
-		TimeoutSeconds:      spec.ToIntRef(10),
-		FailureThreshold:    spec.ToIntRef(10),
-		SuccessThreshold:    spec.ToIntRef(10),
+		Probe: spec.Probe{
+			InitialDelaySeconds: spec.ToIntRef(10),
+			PeriodSeconds:       spec.ToIntRef(10),
+			TimeoutSeconds:      spec.ToIntRef(10),
+			FailureThreshold:    spec.ToIntRef(10),
+			SuccessThreshold:    spec.ToIntRef(10),
+		},
 	}
 	testSpec.TCPSocket = &spec.TCPSocketProbe{
 		Port: *spec.ToIntRef(100),
@@ -144,7 +446,7 @@ func TestProberTcp(t *testing.T) {
 				err:    tc.error,
 			}
 			prober := ServiceProber{tcp: mockTcpProbe}
-			r := prober.probe(testSpec)
+			r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
 			assert.Equal(tt, &ProbeResult{
 				Status: tc.status,
 				Output: tc.output,
@@ -156,11 +458,13 @@ func TestProberTcp(t *testing.T) {
 
 func TestProberHttp(t *testing.T) {
 	testSpec := &spec.LivenessProbe{
-		InitialDelaySeconds: spec.ToIntRef(10),
-		PeriodSeconds:       spec.ToIntRef(10),
-		TimeoutSeconds:      spec.ToIntRef(10),
-		FailureThreshold:    spec.ToIntRef(10),
-		SuccessThreshold:    spec.ToIntRef(10),
+		Probe: spec.Probe{
+			InitialDelaySeconds: spec.ToIntRef(10),
+			PeriodSeconds:       spec.ToIntRef(10),
+			TimeoutSeconds:      spec.ToIntRef(10),
+			FailureThreshold:    spec.ToIntRef(10),
+			SuccessThreshold:    spec.ToIntRef(10),
+		},
 	}
 	testSpec.HTTPGet = &spec.HTTPGetProbe{
 		Port: 100,
@@ -183,12 +487,560 @@ func TestProberHttp(t *testing.T) {
 				err:    tc.error,
 			}
 			prober := ServiceProber{http: mockTcpProbe}
-			r := prober.probe(testSpec)
+			r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+			assert.Equal(tt, &ProbeResult{
+				Status: tc.status,
+				Output: tc.output,
+				Error:  tc.error,
+			}, r)
+		})
+	}
+}
+
+func TestProberGrpc(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		Probe: spec.Probe{
+			InitialDelaySeconds: spec.ToIntRef(10),
+			PeriodSeconds:       spec.ToIntRef(10),
+			TimeoutSeconds:      spec.ToIntRef(10),
+			FailureThreshold:    spec.ToIntRef(10),
+			SuccessThreshold:    spec.ToIntRef(10),
+		},
+	}
+	testSpec.GRPC = &spec.GRPCProbe{
+		Host:    "localhost",
+		Port:    100,
+		Service: "test",
+	}
+	testCases := []struct {
+		name   string
+		status status.Status
+		output string
+		error  error
+	}{
+		{"normal run", status.Success, "SERVING", nil},
+		{"failed run", status.Failure, "NOT_SERVING", fmt.Errorf("test")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			mockGrpcProbe := &MockGrpcProbe{
+				status: tc.status,
+				output: tc.output,
+				err:    tc.error,
+			}
+			prober := ServiceProber{grpc: mockGrpcProbe}
+			r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+			assert.Equal(tt, &ProbeResult{
+				Status: tc.status,
+				Output: tc.output,
+				Error:  tc.error,
+			}, r)
+		})
+	}
+}
+
+func TestProberHttpExpectations(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "test",
+		Probe: spec.Probe{
+			ProbeHandler: spec.ProbeHandler{HTTP: &spec.HTTPProbe{
+				URL:                 "http://test.com/health",
+				Method:              "post",
+				Body:                `{"deep": true}`,
+				ExpectedStatusCodes: []string{"200-204", "418"},
+				BodyMatches:         []string{"ok|fine"},
+				JSONPath:            []spec.JSONPathAssertion{{Path: "$.status", Value: "ok"}},
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+
+	mockHttpProbe := &MockHttpProbe{status: status.Success, output: "ok"}
+	prober := ServiceProber{http: mockHttpProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Success, Output: "ok"}, r)
+	assert.Equal(t, "POST", mockHttpProbe.req.Method)
+	assert.Equal(t, "/health", mockHttpProbe.req.URL.Path)
+	assert.Equal(t, []probe.StatusCodeRange{{Min: 200, Max: 204}, {Min: 418, Max: 418}}, mockHttpProbe.expect.StatusCodes)
+	assert.Len(t, mockHttpProbe.expect.BodyMatches, 1)
+	assert.Equal(t, []probe.JSONPathAssertion{{Path: "$.status", Value: "ok"}}, mockHttpProbe.expect.JSONPaths)
+}
+
+func TestProberTls(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "test",
+		Probe: spec.Probe{
+			ProbeHandler: spec.ProbeHandler{TLS: &spec.TLSProbe{Host: "example.com", Port: 443}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	testCases := []struct {
+		name   string
+		status status.Status
+		output string
+		error  error
+	}{
+		{"normal run", status.Success, "valid", nil},
+		{"expiring", status.Warning, "expires in 2 days", nil},
+		{"failed run", status.Failure, "expired", fmt.Errorf("test")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			mockTlsProbe := &MockTlsProbe{
+				status: tc.status,
+				output: tc.output,
+				err:    tc.error,
+			}
+			prober := ServiceProber{tls: mockTlsProbe}
+			r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+			assert.Equal(tt, &ProbeResult{
+				Status: tc.status,
+				Output: tc.output,
+				Error:  tc.error,
+			}, r)
+			assert.Equal(tt, "example.com", mockTlsProbe.serverName)
+			assert.Equal(tt, 14*24*time.Hour, mockTlsProbe.warnWithin)
+		})
+	}
+}
+
+func TestProberTcpSteps(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "test",
+		Probe: spec.Probe{
+			ProbeHandler: spec.ProbeHandler{TCPSocket: &spec.TCPSocketProbe{
+				Port: 6379,
+				Steps: []spec.TCPStep{
+					{SendHex: "50494e470d0a", Expect: "+PONG", TimeoutSeconds: spec.ToIntRef(2)},
+					{Send: "INFO replication\r\n", ExpectRegex: "role:master"},
+				},
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockTcpProbe := &MockTcpProbe{status: status.Success}
+	prober := ServiceProber{tcp: mockTcpProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, status.Success, r.Status)
+	assert.Len(t, mockTcpProbe.steps, 2)
+	assert.Equal(t, []byte("PING\r\n"), mockTcpProbe.steps[0].Send)
+	assert.Equal(t, []byte("+PONG"), mockTcpProbe.steps[0].Expect)
+	assert.Equal(t, 2*time.Second, mockTcpProbe.steps[0].Timeout)
+	assert.Equal(t, "role:master", mockTcpProbe.steps[1].ExpectRegex.String())
+
+	testSpec.TCPSocket.Steps[0].Send = "PING\r\n"
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberTcpTarget(t *testing.T) {
+	testCases := []struct {
+		name     string
+		socket   *spec.TCPSocketProbe
+		network  string
+		addr     string
+		hasError bool
+	}{
+		{"default host", &spec.TCPSocketProbe{Port: 80}, "tcp", "localhost:80", false},
+		{"ipv4", &spec.TCPSocketProbe{Host: "10.0.0.1", Port: 80, IPFamily: "ipv4"}, "tcp4", "10.0.0.1:80", false},
+		{"ipv6", &spec.TCPSocketProbe{Host: "::1", Port: 80, IPFamily: "ipv6"}, "tcp6", "[::1]:80", false},
+		{"unix", &spec.TCPSocketProbe{Host: "unix:/run/app.sock"}, "unix", "/run/app.sock", false},
+		{"unix url form", &spec.TCPSocketProbe{Host: "unix:///run/app.sock"}, "unix", "/run/app.sock", false},
+		{"seqpacket", &spec.TCPSocketProbe{Host: "unix:/run/app.sock", SocketType: "seqpacket"}, "unixpacket", "/run/app.sock", false},
+		{"seqpacket over tcp", &spec.TCPSocketProbe{Port: 80, SocketType: "seqpacket"}, "", "", true},
+		{"unknown family", &spec.TCPSocketProbe{Port: 80, IPFamily: "ipx"}, "", "", true},
+		{"empty unix path", &spec.TCPSocketProbe{Host: "unix:"}, "", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			testSpec := &spec.LivenessProbe{ServiceName: "test", Probe: spec.Probe{ProbeHandler: spec.ProbeHandler{TCPSocket: tc.socket}}}
+			err := testSpec.Validate()
+			if tc.hasError {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			mockTcpProbe := &MockTcpProbe{status: status.Success}
+			prober := ServiceProber{tcp: mockTcpProbe}
+			prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+			assert.Equal(tt, tc.network, mockTcpProbe.network)
+			assert.Equal(tt, tc.addr, mockTcpProbe.addr)
+		})
+	}
+}
+
+func TestProberUnit(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "test.service",
+		Probe: spec.Probe{
+			ProbeHandler: spec.ProbeHandler{Unit: &spec.UnitProbe{
+				MaxActivatingSeconds: spec.ToIntRef(120),
+				MaxRestarts:          3,
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	testCases := []struct {
+		name   string
+		status status.Status
+		output string
+		error  error
+	}{
+		{"normal run", status.Success, "ActiveState=active", nil},
+		{"failed run", status.Failure, "ActiveState=failed", fmt.Errorf("test")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			mockUnitProbe := &MockUnitProbe{
+				status: tc.status,
+				output: tc.output,
+				err:    tc.error,
+			}
+			prober := ServiceProber{unit: mockUnitProbe}
+			r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
 			assert.Equal(tt, &ProbeResult{
 				Status: tc.status,
 				Output: tc.output,
 				Error:  tc.error,
 			}, r)
+			assert.Equal(tt, "test.service", mockUnitProbe.unitName)
+			assert.Equal(tt, 2*time.Minute, mockUnitProbe.maxActivating)
+			assert.Equal(tt, 3, mockUnitProbe.maxRestarts)
+			assert.Equal(tt, 10*time.Minute, mockUnitProbe.restartWindow)
+		})
+	}
+}
+
+func TestProberResources(t *testing.T) {
+	warning, failure := 256.0, 512.0
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "test.service",
+		Probe: spec.Probe{
+			ProbeHandler: spec.ProbeHandler{Resources: &spec.ResourcesProbe{
+				RSSMegabytes: &spec.Threshold{Warning: &warning, Failure: &failure},
+				Threads:      &spec.Threshold{Failure: &failure},
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockResourcesProbe := &MockResourcesProbe{status: status.Warning, output: "rss_bytes 300"}
+	prober := ServiceProber{resources: mockResourcesProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Warning, Output: "rss_bytes 300"}, r)
+	assert.Equal(t, 256.0*1024*1024, *mockResourcesProbe.limits.RSSBytes.Warning)
+	assert.Equal(t, 512.0*1024*1024, *mockResourcesProbe.limits.RSSBytes.Failure)
+	assert.Nil(t, mockResourcesProbe.limits.Threads.Warning)
+	assert.Equal(t, 512.0, *mockResourcesProbe.limits.Threads.Failure)
+	assert.Nil(t, mockResourcesProbe.limits.CPUPercent.Failure)
+
+	testSpec.Resources.RSSMegabytes = &spec.Threshold{Warning: &failure, Failure: &warning}
+	assert.Error(t, testSpec.Validate())
+	testSpec.Resources = &spec.ResourcesProbe{}
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberJournal(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "test.service",
+		Probe: spec.Probe{
+			ProbeHandler: spec.ProbeHandler{Journal: &spec.JournalProbe{
+				Patterns:   []string{"panic:", "(?i)out of memory"},
+				MaxMatches: 2,
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	assert.Equal(t, 300, *testSpec.Journal.WindowSeconds)
+	mockJournalProbe := &MockJournalProbe{status: status.Failure, output: "3 journal entries matched"}
+	prober := ServiceProber{journal: mockJournalProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Failure, Output: "3 journal entries matched"}, r)
+	assert.Len(t, mockJournalProbe.patterns, 2)
+	assert.Equal(t, "(?i)out of memory", mockJournalProbe.patterns[1].String())
+	assert.Equal(t, 2, mockJournalProbe.maxMatches)
+	assert.Equal(t, 5*time.Minute, mockJournalProbe.window)
+
+	testSpec.Journal.Patterns = []string{"("}
+	assert.Error(t, testSpec.Validate())
+	testSpec.Journal.Patterns = nil
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberDNS(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "unbound.service",
+		Probe: spec.Probe{
+			TimeoutSeconds: spec.ToIntRef(1),
+			ProbeHandler: spec.ProbeHandler{DNS: &spec.DNSProbe{
+				Server:                 "127.0.0.1",
+				Name:                   "example.com",
+				Type:                   "mx",
+				ExpectedValues:         []string{"10 mail.example.com"},
+				MaxLatencyMilliseconds: 200,
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockDnsProbe := &MockDnsProbe{status: status.Success, output: "answers=[10 mail.example.com.]"}
+	prober := ServiceProber{dns: mockDnsProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Success, Output: "answers=[10 mail.example.com.]"}, r)
+	assert.Equal(t, "127.0.0.1:53", mockDnsProbe.server)
+	assert.Equal(t, "udp", mockDnsProbe.network)
+	assert.Equal(t, "example.com", mockDnsProbe.name)
+	assert.Equal(t, dnsmessage.TypeMX, mockDnsProbe.qtype)
+	assert.Equal(t, probe.DNSExpectations{
+		Rcode:         dnsmessage.RCodeSuccess,
+		RequireAnswer: true,
+		Values:        []string{"10 mail.example.com"},
+		MaxLatency:    200 * time.Millisecond,
+	}, mockDnsProbe.expect)
+
+	testSpec.DNS = &spec.DNSProbe{Name: "missing.example.com", Rcode: "NXDOMAIN"}
+	assert.NoError(t, testSpec.Validate())
+	assert.False(t, *testSpec.DNS.ExpectAnswer)
+	testSpec.DNS.Type = "HINFO"
+	assert.Error(t, testSpec.Validate())
+	testSpec.DNS = &spec.DNSProbe{}
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberUDP(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "chronyd.service",
+		Probe: spec.Probe{
+			TimeoutSeconds: spec.ToIntRef(1),
+			ProbeHandler: spec.ProbeHandler{UDP: &spec.UDPProbe{
+				Port:        123,
+				IPFamily:    "ipv4",
+				SendHex:     "e3000000",
+				ExpectRegex: "^\\x24",
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockUdpProbe := &MockUdpProbe{status: status.Failure, output: "port unreachable"}
+	prober := ServiceProber{udp: mockUdpProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Failure, Output: "port unreachable"}, r)
+	assert.Equal(t, "udp4", mockUdpProbe.network)
+	assert.Equal(t, "localhost:123", mockUdpProbe.addr)
+	assert.Equal(t, []byte{0xe3, 0, 0, 0}, mockUdpProbe.exchange.Send)
+	assert.Nil(t, mockUdpProbe.exchange.Expect)
+	assert.Equal(t, "^\\x24", mockUdpProbe.exchange.ExpectRegex.String())
+
+	testSpec.UDP.Send = "ping"
+	assert.Error(t, testSpec.Validate())
+	testSpec.UDP = &spec.UDPProbe{}
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberPostgres(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(passwordFile, []byte("s3cret\n"), 0600))
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "postgresql.service",
+		Probe: spec.Probe{
+			TimeoutSeconds: spec.ToIntRef(2),
+			ProbeHandler:   spec.ProbeHandler{Postgres: &spec.PostgresProbe{User: "monitor", PasswordFile: passwordFile}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockSqlProbe := &MockSqlProbe{status: status.Success, output: "SELECT 1 returned 1"}
+	prober := ServiceProber{sql: mockSqlProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Success, Output: "SELECT 1 returned 1"}, r)
+	assert.Equal(t, "postgres", mockSqlProbe.driverName)
+	assert.Equal(t, "host='localhost' port='5432' user='monitor' password='s3cret' sslmode='disable' connect_timeout='2'", mockSqlProbe.dsn)
+	assert.Equal(t, "SELECT 1", mockSqlProbe.query)
+
+	testSpec.Postgres.PasswordFile = filepath.Join(t.TempDir(), "missing")
+	r = prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, status.Unknown, r.Status)
+	assert.Error(t, r.Error)
+
+	testSpec.Postgres.Password = "s3cret"
+	assert.Error(t, testSpec.Validate())
+	testSpec.Postgres = &spec.PostgresProbe{}
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberMySQL(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "mariadb.service",
+		Probe: spec.Probe{
+			TimeoutSeconds: spec.ToIntRef(2),
+			ProbeHandler:   spec.ProbeHandler{MySQL: &spec.MySQLProbe{SocketPath: "/run/mysqld/mysqld.sock", User: "monitor"}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockSqlProbe := &MockSqlProbe{status: status.Failure, output: "Error 1045 (28000): Access denied"}
+	prober := ServiceProber{sql: mockSqlProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Failure, Output: "Error 1045 (28000): Access denied"}, r)
+	assert.Equal(t, "mysql", mockSqlProbe.driverName)
+	assert.Equal(t, "monitor@unix(/run/mysqld/mysqld.sock)/?timeout=2s", mockSqlProbe.dsn)
+	assert.Equal(t, "", mockSqlProbe.query)
+}
+
+func TestProberRedis(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "redis.service",
+		Probe: spec.Probe{
+			TimeoutSeconds: spec.ToIntRef(1),
+			ProbeHandler:   spec.ProbeHandler{Redis: &spec.RedisProbe{Password: "s3cret", ExpectedRole: "master"}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockRedisProbe := &MockRedisProbe{status: status.Success, output: "PONG role=master"}
+	prober := ServiceProber{redis: mockRedisProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Success, Output: "PONG role=master"}, r)
+	assert.Equal(t, "tcp", mockRedisProbe.network)
+	assert.Equal(t, "localhost:6379", mockRedisProbe.addr)
+	assert.Equal(t, "s3cret", mockRedisProbe.password)
+	assert.Equal(t, "master", mockRedisProbe.expectedRole)
+
+	testSpec.Redis.ExpectedRole = "primary"
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberWebSocket(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "gateway.service",
+		Probe: spec.Probe{
+			TimeoutSeconds: spec.ToIntRef(1),
+			ProbeHandler: spec.ProbeHandler{WebSocket: &spec.WebSocketProbe{
+				URL:    "wss://localhost:8443/ws",
+				TLS:    &spec.TLSClientConfig{InsecureSkipVerify: true},
+				Send:   `{"type":"ping"}`,
+				Expect: `{"type":"pong"}`,
+			}},
+		},
+	}
+	testSpec.WebSocket.HTTPHeaders = append(testSpec.WebSocket.HTTPHeaders, struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	}{Name: "Authorization", Value: "Bearer token"})
+	assert.NoError(t, testSpec.Validate())
+	mockWebsocketProbe := &MockWebsocketProbe{status: status.Failure, output: "handshake failed with status 200 OK"}
+	prober := ServiceProber{websocket: mockWebsocketProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Failure, Output: "handshake failed with status 200 OK"}, r)
+	assert.Equal(t, "wss://localhost:8443/ws", mockWebsocketProbe.url)
+	assert.Equal(t, "Bearer token", mockWebsocketProbe.header.Get("Authorization"))
+	assert.True(t, mockWebsocketProbe.tlsConfig.InsecureSkipVerify)
+	assert.Equal(t, []byte(`{"type":"ping"}`), mockWebsocketProbe.exchange.Send)
+	assert.Equal(t, []byte(`{"type":"pong"}`), mockWebsocketProbe.exchange.Expect)
+
+	testSpec.WebSocket.Send = ""
+	assert.Error(t, testSpec.Validate())
+	testSpec.WebSocket = &spec.WebSocketProbe{URL: "http://localhost/ws"}
+	assert.Error(t, testSpec.Validate())
+}
+
+func TestProberFile(t *testing.T) {
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "exporter.service",
+		Probe: spec.Probe{
+			ProbeHandler: spec.ProbeHandler{File: &spec.FileProbe{
+				Path:          "/run/exporter/heartbeat",
+				MaxAgeSeconds: 120,
+				MaxSizeBytes:  4096,
+				ContentRegex:  "^ok",
+			}},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	mockFileProbe := &MockFileProbe{status: status.Failure, output: "older than 2m0s"}
+	prober := ServiceProber{file: mockFileProbe}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, &ProbeResult{Status: status.Failure, Output: "older than 2m0s"}, r)
+	assert.Equal(t, "/run/exporter/heartbeat", mockFileProbe.path)
+	assert.Equal(t, 2*time.Minute, mockFileProbe.expect.MaxAge)
+	assert.Equal(t, int64(4096), mockFileProbe.expect.MaxSize)
+	assert.Equal(t, "^ok", mockFileProbe.expect.ContentRegex.String())
+
+	testSpec.File.MinSizeBytes = 8192
+	assert.ErrorContains(t, testSpec.Validate(), "larger than maxSizeBytes")
+	testSpec.File = &spec.FileProbe{Path: "/run/exporter/heartbeat", ContentRegex: "("}
+	assert.ErrorContains(t, testSpec.Validate(), "invalid contentRegex")
+	testSpec.File = &spec.FileProbe{}
+	assert.ErrorContains(t, testSpec.Validate(), "must define a path")
+}
+
+func TestProberChecksToleratedWarning(t *testing.T) {
+	limit := 512.0
+	testSpec := &spec.LivenessProbe{
+		ServiceName: "gateway.service",
+		Probe: spec.Probe{
+			Require: "all",
+			Checks: []*spec.Check{
+				{ProbeHandler: spec.ProbeHandler{Resources: &spec.ResourcesProbe{RSSMegabytes: &spec.Threshold{Warning: &limit}}}},
+				{ProbeHandler: spec.ProbeHandler{TLS: &spec.TLSProbe{Port: 443}}},
+			},
+		},
+	}
+	assert.NoError(t, testSpec.Validate())
+	prober := ServiceProber{
+		resources: &MockResourcesProbe{status: status.Warning, output: "approaching limit"},
+		tls:       &MockTlsProbe{status: status.Warning, output: "certificate expires in 13 days"},
+	}
+	r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+	assert.Equal(t, status.Warning, r.Status)
+	assert.Equal(t, "2 of 2 checks passed, 2 required (resources#1: Warning, tls#2: Warning)", r.Output)
+}
+
+func TestProberChecks(t *testing.T) {
+	newSpec := func() *spec.LivenessProbe {
+		return &spec.LivenessProbe{
+			ServiceName: "gateway.service",
+			Probe: spec.Probe{
+				Checks: []*spec.Check{
+					{ProbeHandler: spec.ProbeHandler{Exec: &spec.ExecProbe{Command: []string{"true"}}}},
+					{Name: "socket", ProbeHandler: spec.ProbeHandler{TCPSocket: &spec.TCPSocketProbe{Host: "unix:/run/gateway.sock"}}},
+					{ProbeHandler: spec.ProbeHandler{UDP: &spec.UDPProbe{Port: 8125}}},
+				},
+			},
+		}
+	}
+	testCases := []struct {
+		name           string
+		require        string
+		atLeast        *int
+		execStatus     status.Status
+		tcpStatus      status.Status
+		udpStatus      status.Status
+		expectedStatus status.Status
+		expectedOutput string
+	}{
+		{"all passed", "", nil, status.Success, status.Success, status.Success, status.Success, "3 of 3 checks passed, 3 required"},
+		{"warning of a tcp check", "all", nil, status.Success, status.Warning, status.Success, status.Failure, "2 of 3 checks passed, 3 required (socket: Warning)"},
+		{"any with warning", "any", nil, status.Warning, status.Success, status.Failure, status.Warning, "1 of 3 checks passed, 1 required (exec#1: Warning, udp#3: Failure)"},
+		{"all with failure", "all", nil, status.Success, status.Failure, status.Success, status.Failure, "2 of 3 checks passed, 3 required (socket: Failure)"},
+		{"any", "any", nil, status.Failure, status.Unknown, status.Success, status.Warning, "1 of 3 checks passed, 1 required (exec#1: Failure, socket: UNKNOWN)"},
+		{"any failed", "any", nil, status.Failure, status.Failure, status.Unknown, status.Failure, "0 of 3 checks passed, 1 required"},
+		{"at least", "", spec.ToIntRef(2), status.Success, status.Failure, status.Success, status.Warning, "2 of 3 checks passed, 2 required (socket: Failure)"},
+		{"at least failed", "", spec.ToIntRef(2), status.Success, status.Failure, status.Failure, status.Failure, "1 of 3 checks passed, 2 required"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			testSpec := newSpec()
+			testSpec.Require = tc.require
+			testSpec.AtLeast = tc.atLeast
+			assert.NoError(tt, testSpec.Validate())
+			prober := ServiceProber{
+				exec: &MockExecProbe{status: tc.execStatus, output: "exec output"},
+				tcp:  &MockTcpProbe{status: tc.tcpStatus, output: "tcp output"},
+				udp:  &MockUdpProbe{status: tc.udpStatus, output: "udp output"},
+			}
+			r := prober.probe(testSpec.ServiceName, "liveness", &testSpec.Probe)
+			assert.Equal(tt, tc.expectedStatus, r.Status)
+			assert.Contains(tt, r.Output, tc.expectedOutput)
+			assert.Equal(tt, []*ProbeResult{
+				{Name: "exec#1", Status: tc.execStatus, Output: "exec output"},
+				{Name: "socket", Status: tc.tcpStatus, Output: "tcp output"},
+				{Name: "udp#3", Status: tc.udpStatus, Output: "udp output"},
+			}, r.SubResults)
 		})
 	}
 }
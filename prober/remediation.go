@@ -0,0 +1,156 @@
+package prober
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/glendsoza/sprobe/probe"
+	"github.com/glendsoza/sprobe/spec"
+	"github.com/glendsoza/sprobe/status"
+	"github.com/rs/zerolog/log"
+)
+
+// remediate runs the actions of the current escalation step of an unhealthy
+// service in order, unless the service is silenced, the step is still being
+// verified or the restart policy holds them back. A failed action does not
+// stop the ones after it, so that e.g. a restart still happens when the kill
+// meant to get a thread dump found no process.
+func (pm *ProberManager) remediate(lp *spec.LivenessProbe) {
+	ladder := lp.Ladder()
+	if len(ladder) == 0 {
+		return
+	}
+	if silence, ok := pm.silences.silenced(lp.ServiceName, "remediation"); ok {
+		log.Warn().Str("service_name", lp.ServiceName).
+			Str("reason", silence.reason()).
+			Msg("remediation skipped")
+		return
+	}
+	pm.restarts.unhealthy(lp.ServiceName)
+	step, ok, reason := pm.restarts.escalate(lp.ServiceName, ladder)
+	if ok {
+		ok, reason = pm.restarts.allow(lp.ServiceName, lp.RestartPolicy)
+	}
+	if !ok {
+		log.Warn().Str("service_name", lp.ServiceName).
+			Str("reason", reason).
+			Msg("remediation skipped")
+		return
+	}
+	pm.restarts.escalated(lp.ServiceName, step, time.Duration(*ladder[step].VerifySeconds)*time.Second)
+	if len(ladder) > 1 {
+		log.Info().Str("service_name", lp.ServiceName).
+			Int("step", step+1).
+			Str("name", ladder[step].Name).
+			Msg("escalating")
+	}
+	for _, action := range ladder[step].Actions {
+		if action.Action == "restart" {
+			restartMetrics.WithLabelValues(lp.ServiceName).Inc()
+		}
+		output, err := pm.runRemediationAction(lp.ServiceName, action)
+		log.Info().Str("service_name", lp.ServiceName).
+			Str("action", action.Action).
+			Str("unit", action.Unit).
+			Str("output", output).
+			Err(err).
+			Msg("remediated")
+	}
+	pm.verifyUnitState(lp.ServiceName)
+}
+
+// verifyUnitState fails the remediation right away when the unit did not
+// come back. Whether it is healthy again is verified by the probes that
+// follow.
+func (pm *ProberManager) verifyUnitState(serviceName string) {
+	state, err := pm.unitsManager.State(serviceName)
+	if err != nil {
+		log.Warn().Str("service_name", serviceName).Err(err).Msg("unable to read the unit state")
+		return
+	}
+	if state.ActiveState == "failed" || state.ActiveState == "inactive" {
+		pm.restarts.remediationFailed(serviceName, fmt.Sprintf("unit is %s (%s) after remediation", state.ActiveState, state.SubState))
+	}
+}
+
+func (pm *ProberManager) runRemediationAction(serviceName string, action *spec.RemediationAction) (string, error) {
+	timeout := time.Duration(*action.TimeoutSeconds) * time.Second
+	switch action.Action {
+	case "restart":
+		return pm.unitsManager.Restart(action.Unit, action.Mode, timeout)
+	case "reload":
+		return pm.unitsManager.Reload(action.Unit, action.Mode, timeout)
+	case "stop":
+		return pm.unitsManager.Stop(action.Unit, action.Mode, timeout)
+	case "start":
+		return pm.unitsManager.Start(action.Unit, action.Mode, timeout)
+	case "kill":
+		signal, err := spec.ParseSignal(action.Signal)
+		if err != nil {
+			return "", err
+		}
+		return "", pm.unitsManager.Kill(action.Unit, action.Who, signal, timeout)
+	case "reset-failed":
+		return "", pm.unitsManager.ResetFailed(action.Unit, timeout)
+	case "restart-dependencies":
+		return pm.restartDependencies(action, timeout)
+	case "exec":
+		return runRemediationHook(serviceName, action.Command, timeout)
+	}
+	return "", fmt.Errorf("unsupported remediation action %q", action.Action)
+}
+
+// restartDependencies restarts the configured dependencies, or else the
+// services listed in Requires= of the unit, one after the other, each within
+// timeout. Requires= also lists what systemd adds implicitly, such as
+// system.slice, sysinit.target and mounts, whose restart would take down
+// every service on the host, so only services are restarted.
+func (pm *ProberManager) restartDependencies(action *spec.RemediationAction, timeout time.Duration) (string, error) {
+	units := action.Dependencies
+	if len(units) == 0 {
+		state, err := pm.unitsManager.State(action.Unit)
+		if err != nil {
+			return "", err
+		}
+		for _, unit := range state.Requires {
+			if strings.HasSuffix(unit, ".service") {
+				units = append(units, unit)
+			}
+		}
+		if len(units) == 0 {
+			return "", fmt.Errorf("%s requires no services", action.Unit)
+		}
+	}
+	var outputs []string
+	var errs []error
+	for _, unit := range units {
+		output, err := pm.unitsManager.Restart(unit, action.Mode, timeout)
+		outputs = append(outputs, unit+": "+output)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", unit, err))
+		}
+	}
+	return strings.Join(outputs, ", "), errors.Join(errs...)
+}
+
+// runRemediationHook runs command with the name of the service in
+// SPROBE_SERVICE_NAME and fails when it does not exit with zero.
+func runRemediationHook(serviceName string, command []string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd, err := probe.NewCmd(ctx, command, probe.ExecOptions{Env: []string{"SPROBE_SERVICE_NAME=" + serviceName}})
+	if err != nil {
+		return "", err
+	}
+	s, output, err := probe.NewExecProbe().Probe(cmd, spec.DefaultExecOutputLimit)
+	if err != nil {
+		return "", err
+	}
+	if s != status.Success {
+		return output, fmt.Errorf("%s did not exit with zero", command[0])
+	}
+	return output, nil
+}
@@ -0,0 +1,287 @@
+package prober
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/glendsoza/sprobe/spec"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	restartMetrics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sprobe_service_restarts_total",
+		Help: "Restarts of services done by sprobe",
+	},
+		[]string{"service_name"})
+	gaveUpMetrics = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sprobe_service_gave_up",
+		Help: "1 when sprobe gave up restarting a service and it needs human attention, 0 otherwise",
+	},
+		[]string{"service_name"})
+	remediationResultMetrics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sprobe_remediation_results_total",
+		Help: "Outcome of remediations once verified: success when the service became healthy again, failure otherwise",
+	},
+		[]string{"service_name", "result"})
+	escalationMetrics = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sprobe_remediation_escalation_step",
+		Help: "Escalation step last run for a service, counting from 1; 0 when the service is healthy",
+	},
+		[]string{"service_name"})
+)
+
+// restartRecord is the restart history of a service kept across sprobe
+// restarts.
+type restartRecord struct {
+	// Restarts within the window of the restart policy
+	Restarts    []time.Time `json:"restarts"`
+	LastRestart time.Time   `json:"lastRestart"`
+	// Consecutive counts the restarts since the service was last healthy
+	Consecutive int  `json:"consecutive"`
+	GaveUp      bool `json:"gaveUp"`
+	// Step of the escalation ladder, the times it was run and until when its
+	// last run is being verified
+	Step         int       `json:"step"`
+	StepAttempts int       `json:"stepAttempts"`
+	VerifyUntil  time.Time `json:"verifyUntil"`
+	// Unverified is set while the outcome of the last remediation is unknown
+	Unverified bool `json:"unverified"`
+}
+
+// restartTracker applies restart policies. With a path the records are saved
+// after every change, so that restarting sprobe resets neither the backoff
+// nor the restart limit.
+type restartTracker struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]*restartRecord
+	now     func() time.Time
+}
+
+func newRestartTracker(path string) *restartTracker {
+	return &restartTracker{path: path, records: map[string]*restartRecord{}, now: time.Now}
+}
+
+func (rt *restartTracker) load() error {
+	data, err := os.ReadFile(rt.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if err := json.Unmarshal(data, &rt.records); err != nil {
+		return fmt.Errorf("invalid restart state %s: %w", rt.path, err)
+	}
+	for serviceName, record := range rt.records {
+		if record.GaveUp {
+			gaveUpMetrics.WithLabelValues(serviceName).Set(1)
+		}
+		if record.StepAttempts > 0 {
+			escalationMetrics.WithLabelValues(serviceName).Set(float64(record.Step + 1))
+		}
+	}
+	return nil
+}
+
+// save writes the records to path. It must be called with mu held.
+func (rt *restartTracker) save() {
+	if rt.path == "" {
+		return
+	}
+	if err := writeState(rt.path, rt.records); err != nil {
+		log.Warn().Str("file_name", rt.path).Err(err).Msg("unable to save the restart state")
+	}
+}
+
+// writeState writes v as JSON to a temporary file first so that a crash never
+// leaves a truncated state behind.
+func writeState(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (rt *restartTracker) record(serviceName string) *restartRecord {
+	record, ok := rt.records[serviceName]
+	if !ok {
+		record = &restartRecord{}
+		rt.records[serviceName] = record
+	}
+	return record
+}
+
+// allow reports whether serviceName may be restarted now under policy and
+// records the restart if so. Otherwise the returned reason tells why not.
+func (rt *restartTracker) allow(serviceName string, policy *spec.RestartPolicy) (bool, string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	record := rt.record(serviceName)
+	now := rt.now()
+	if record.GaveUp {
+		return false, "gave up restarting, the service needs attention"
+	}
+
+	window := time.Duration(*policy.WindowSeconds) * time.Second
+	restarts := record.Restarts[:0]
+	for _, t := range record.Restarts {
+		if now.Sub(t) < window {
+			restarts = append(restarts, t)
+		}
+	}
+	record.Restarts = restarts
+	if *policy.MaxRestarts > 0 && len(record.Restarts) >= *policy.MaxRestarts {
+		record.GaveUp = true
+		rt.save()
+		gaveUpMetrics.WithLabelValues(serviceName).Set(1)
+		reason := fmt.Sprintf("gave up restarting after %d restarts within %v, the service needs attention", len(record.Restarts), window)
+		log.Error().Str("service_name", serviceName).Msg(reason)
+		return false, reason
+	}
+
+	if record.Consecutive > 0 {
+		backoff := restartBackoff(policy, record.Consecutive)
+		if wait := record.LastRestart.Add(backoff).Sub(now); wait > 0 {
+			return false, fmt.Sprintf("backing off for another %v after %d consecutive restarts", wait.Round(time.Second), record.Consecutive)
+		}
+	}
+	record.Restarts = append(record.Restarts, now)
+	record.LastRestart = now
+	record.Consecutive++
+	rt.save()
+	return true, ""
+}
+
+// escalate picks the step of ladder to run next. It returns false while the
+// last run step is still being verified.
+func (rt *restartTracker) escalate(serviceName string, ladder []*spec.EscalationStep) (int, bool, string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	record := rt.record(serviceName)
+	step := min(record.Step, len(ladder)-1)
+	if record.StepAttempts > 0 {
+		if wait := record.VerifyUntil.Sub(rt.now()); wait > 0 {
+			return 0, false, fmt.Sprintf("verifying %s for another %v", ladder[step].Name, wait.Round(time.Second))
+		}
+		if record.StepAttempts >= *ladder[step].Attempts && step < len(ladder)-1 {
+			step++
+		}
+	}
+	return step, true, ""
+}
+
+// escalated records that step was run and is to be verified for verify.
+func (rt *restartTracker) escalated(serviceName string, step int, verify time.Duration) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	record := rt.record(serviceName)
+	if record.Step != step {
+		record.Step = step
+		record.StepAttempts = 0
+	}
+	record.StepAttempts++
+	record.VerifyUntil = rt.now().Add(verify)
+	record.Unverified = true
+	escalationMetrics.WithLabelValues(serviceName).Set(float64(step + 1))
+	rt.save()
+}
+
+// unhealthy is called when the service failed again. The last remediation
+// failed unless its verification window is still open.
+func (rt *restartTracker) unhealthy(serviceName string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	record := rt.record(serviceName)
+	if record.Unverified && !rt.now().Before(record.VerifyUntil) {
+		rt.verified(serviceName, record, false, "the service is still unhealthy")
+	}
+}
+
+// remediationFailed fails the last remediation right away, e.g. when the
+// unit did not come up at all. Its verification window is closed, so that
+// the next escalation does not wait for a result that is already known.
+func (rt *restartTracker) remediationFailed(serviceName string, reason string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	record := rt.record(serviceName)
+	if record.Unverified {
+		record.VerifyUntil = time.Time{}
+		rt.verified(serviceName, record, false, reason)
+	}
+}
+
+// verified records the outcome of the last remediation. It must be called
+// with mu held.
+func (rt *restartTracker) verified(serviceName string, record *restartRecord, success bool, reason string) {
+	record.Unverified = false
+	rt.save()
+	if success {
+		remediationResultMetrics.WithLabelValues(serviceName, "success").Inc()
+		log.Info().Str("service_name", serviceName).
+			Int("step", record.Step+1).
+			Msg("remediation verified, the service is healthy")
+		return
+	}
+	remediationResultMetrics.WithLabelValues(serviceName, "failure").Inc()
+	log.Warn().Str("service_name", serviceName).
+		Int("step", record.Step+1).
+		Str("reason", reason).
+		Msg("remediation failed")
+}
+
+// recovered resets the backoff and the escalation once the service is
+// healthy. A service that was given up on also gets its restart limit back.
+func (rt *restartTracker) recovered(serviceName string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	record, ok := rt.records[serviceName]
+	if !ok || (record.Consecutive == 0 && !record.GaveUp && record.StepAttempts == 0) {
+		return
+	}
+	if record.Unverified {
+		rt.verified(serviceName, record, true, "")
+	}
+	if record.StepAttempts > 0 {
+		escalationMetrics.WithLabelValues(serviceName).Set(0)
+	}
+	if record.GaveUp {
+		log.Info().Str("service_name", serviceName).Msg("recovered, restarting is enabled again")
+		record.Restarts = nil
+		gaveUpMetrics.WithLabelValues(serviceName).Set(0)
+	}
+	record.Consecutive = 0
+	record.GaveUp = false
+	record.Step = 0
+	record.StepAttempts = 0
+	record.VerifyUntil = time.Time{}
+	rt.save()
+}
+
+// restartBackoff is the time to wait after the consecutive-th restart.
+func restartBackoff(policy *spec.RestartPolicy, consecutive int) time.Duration {
+	backoff := time.Duration(*policy.BackoffSeconds) * time.Second
+	maxBackoff := time.Duration(*policy.MaxBackoffSeconds) * time.Second
+	for i := 1; i < consecutive && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
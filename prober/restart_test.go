@@ -0,0 +1,186 @@
+package prober
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/spec"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartTracker(t *testing.T) {
+	policy := &spec.RestartPolicy{
+		BackoffSeconds:    spec.ToIntRef(10),
+		MaxBackoffSeconds: spec.ToIntRef(30),
+		MaxRestarts:       spec.ToIntRef(5),
+		WindowSeconds:     spec.ToIntRef(3600),
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rt := newRestartTracker("")
+	rt.now = func() time.Time { return now }
+	allowAfter := func(d time.Duration) bool {
+		now = now.Add(d)
+		ok, _ := rt.allow("flappy.service", policy)
+		return ok
+	}
+
+	assert.True(t, allowAfter(0), "the first restart is immediate")
+	assert.False(t, allowAfter(9*time.Second))
+	assert.True(t, allowAfter(time.Second))
+	assert.False(t, allowAfter(19*time.Second), "the backoff doubles")
+	assert.True(t, allowAfter(time.Second))
+	assert.False(t, allowAfter(29*time.Second), "the backoff is capped")
+	assert.True(t, allowAfter(time.Second))
+
+	rt.recovered("flappy.service")
+	assert.True(t, allowAfter(time.Second), "recovering resets the backoff")
+	ok, reason := rt.allow("flappy.service", policy)
+	assert.False(t, ok)
+	assert.Contains(t, reason, "gave up restarting after 5 restarts")
+	assert.Equal(t, 1.0, testutil.ToFloat64(gaveUpMetrics.WithLabelValues("flappy.service")))
+	assert.False(t, allowAfter(2*time.Hour), "giving up is terminal")
+
+	rt.recovered("flappy.service")
+	assert.Equal(t, 0.0, testutil.ToFloat64(gaveUpMetrics.WithLabelValues("flappy.service")))
+	assert.True(t, allowAfter(0))
+}
+
+func TestRestartTrackerWindow(t *testing.T) {
+	policy := &spec.RestartPolicy{
+		BackoffSeconds:    spec.ToIntRef(0),
+		MaxBackoffSeconds: spec.ToIntRef(0),
+		MaxRestarts:       spec.ToIntRef(2),
+		WindowSeconds:     spec.ToIntRef(60),
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rt := newRestartTracker("")
+	rt.now = func() time.Time { return now }
+	for range 5 {
+		ok, _ := rt.allow("slow.service", policy)
+		assert.True(t, ok, "restarts older than the window do not count")
+		now = now.Add(31 * time.Second)
+	}
+}
+
+func TestRestartTrackerPersistence(t *testing.T) {
+	policy := &spec.RestartPolicy{
+		BackoffSeconds:    spec.ToIntRef(60),
+		MaxBackoffSeconds: spec.ToIntRef(60),
+		MaxRestarts:       spec.ToIntRef(1),
+		WindowSeconds:     spec.ToIntRef(3600),
+	}
+	path := filepath.Join(t.TempDir(), "state", "restarts.json")
+	rt := newRestartTracker(path)
+	assert.NoError(t, rt.load(), "a missing state file is not an error")
+	ok, _ := rt.allow("broken.service", policy)
+	assert.True(t, ok)
+
+	rt = newRestartTracker(path)
+	assert.NoError(t, rt.load())
+	ok, reason := rt.allow("broken.service", policy)
+	assert.False(t, ok)
+	assert.Contains(t, reason, "gave up")
+
+	rt = newRestartTracker(path)
+	assert.NoError(t, rt.load())
+	assert.True(t, rt.records["broken.service"].GaveUp)
+	assert.Equal(t, 1.0, testutil.ToFloat64(gaveUpMetrics.WithLabelValues("broken.service")))
+
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	assert.Error(t, newRestartTracker(path).load())
+}
+
+func TestRestartTrackerEscalation(t *testing.T) {
+	ladder := []*spec.EscalationStep{
+		{Name: "reload", Attempts: spec.ToIntRef(2), VerifySeconds: spec.ToIntRef(30)},
+		{Name: "restart", Attempts: spec.ToIntRef(1), VerifySeconds: spec.ToIntRef(60)},
+		{Name: "reboot", Attempts: spec.ToIntRef(1), VerifySeconds: spec.ToIntRef(0)},
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rt := newRestartTracker("")
+	rt.now = func() time.Time { return now }
+	escalateAfter := func(d time.Duration) (int, bool) {
+		now = now.Add(d)
+		step, ok, _ := rt.escalate("ladder.service", ladder)
+		if ok {
+			rt.escalated("ladder.service", step, time.Duration(*ladder[step].VerifySeconds)*time.Second)
+		}
+		return step, ok
+	}
+
+	steps := []struct {
+		after        time.Duration
+		expectedStep int
+		expectedOk   bool
+	}{
+		{0, 0, true},
+		{10 * time.Second, 0, false},
+		{20 * time.Second, 0, true},
+		{30 * time.Second, 1, true},
+		{59 * time.Second, 0, false},
+		{time.Second, 2, true},
+		{0, 2, true},
+	}
+	for i, s := range steps {
+		step, ok := escalateAfter(s.after)
+		assert.Equal(t, s.expectedOk, ok, "cycle %d", i)
+		if ok {
+			assert.Equal(t, s.expectedStep, step, "cycle %d", i)
+		}
+	}
+	assert.Equal(t, 3.0, testutil.ToFloat64(escalationMetrics.WithLabelValues("ladder.service")))
+
+	rt.recovered("ladder.service")
+	assert.Equal(t, 0.0, testutil.ToFloat64(escalationMetrics.WithLabelValues("ladder.service")))
+	step, ok := escalateAfter(0)
+	assert.True(t, ok)
+	assert.Equal(t, 0, step, "recovering starts over at the first step")
+}
+
+func TestRestartTrackerVerification(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rt := newRestartTracker("")
+	rt.now = func() time.Time { return now }
+	// the counters are global, so only what this test added is compared
+	counts := func() (float64, float64) {
+		return testutil.ToFloat64(remediationResultMetrics.WithLabelValues("verified.service", "success")),
+			testutil.ToFloat64(remediationResultMetrics.WithLabelValues("verified.service", "failure"))
+	}
+	successBefore, failureBefore := counts()
+	results := func() (float64, float64) {
+		success, failure := counts()
+		return success - successBefore, failure - failureBefore
+	}
+
+	rt.escalated("verified.service", 0, time.Minute)
+	rt.recovered("verified.service")
+	success, failure := results()
+	assert.Equal(t, 1.0, success)
+	assert.Equal(t, 0.0, failure)
+
+	rt.escalated("verified.service", 0, time.Minute)
+	now = now.Add(30 * time.Second)
+	rt.unhealthy("verified.service")
+	_, failure = results()
+	assert.Equal(t, 0.0, failure, "failing within the verification window is not final")
+	now = now.Add(30 * time.Second)
+	rt.unhealthy("verified.service")
+	rt.unhealthy("verified.service")
+	_, failure = results()
+	assert.Equal(t, 1.0, failure, "a remediation is only failed once")
+
+	ladder := []*spec.EscalationStep{{Name: "restart", Attempts: spec.ToIntRef(1), VerifySeconds: spec.ToIntRef(60)}}
+	rt.escalated("verified.service", 0, time.Minute)
+	_, ok, _ := rt.escalate("verified.service", ladder)
+	assert.False(t, ok, "verifying")
+	rt.remediationFailed("verified.service", "unit is failed")
+	_, ok, _ = rt.escalate("verified.service", ladder)
+	assert.True(t, ok, "a failed remediation is not verified any longer")
+	rt.recovered("verified.service")
+	success, failure = results()
+	assert.Equal(t, 1.0, success)
+	assert.Equal(t, 2.0, failure)
+}
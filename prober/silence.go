@@ -0,0 +1,299 @@
+package prober
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/glendsoza/sprobe/spec"
+	"github.com/rs/zerolog/log"
+)
+
+// Silence is a silence in effect, either added for a duration or opened by a
+// maintenance window.
+type Silence struct {
+	ID string `json:"id"`
+	spec.Silence
+	Until time.Time `json:"until"`
+	// Schedule is set for silences of maintenance windows, which cannot be
+	// expired
+	Schedule string `json:"schedule,omitempty"`
+}
+
+func (s *Silence) reason() string {
+	reason := fmt.Sprintf("silenced by %s until %s", s.ID, s.Until.Format(time.RFC3339))
+	if s.Comment != "" {
+		reason += ": " + s.Comment
+	}
+	return reason
+}
+
+// silencer keeps the maintenance windows and the silences added for a
+// duration. Expired silences are dropped the next time they are looked at.
+// With a path the silences added for a duration are saved after every
+// change, so that restarting sprobe in the middle of a deploy keeps them.
+type silencer struct {
+	mu       sync.Mutex
+	path     string
+	windows  []*spec.MaintenanceWindow
+	silences map[string]*Silence
+	lastID   int
+	// probing holds the silence each service is not probed for, so that only
+	// its start and end are logged
+	probing map[string]string
+	now     func() time.Time
+}
+
+// silencesState is the saved state of a silencer.
+type silencesState struct {
+	LastID   int                 `json:"lastID"`
+	Silences map[string]*Silence `json:"silences"`
+}
+
+func newSilencer(path string) *silencer {
+	return &silencer{path: path, silences: map[string]*Silence{}, probing: map[string]string{}, now: time.Now}
+}
+
+func (s *silencer) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := silencesState{Silences: map[string]*Silence{}}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid silences %s: %w", s.path, err)
+	}
+	s.lastID = state.LastID
+	s.silences = state.Silences
+	return nil
+}
+
+// save writes the silences to path. It must be called with mu held.
+func (s *silencer) save() {
+	if s.path == "" {
+		return
+	}
+	if err := writeState(s.path, silencesState{LastID: s.lastID, Silences: s.silences}); err != nil {
+		log.Warn().Str("file_name", s.path).Err(err).Msg("unable to save the silences")
+	}
+}
+
+func (s *silencer) addWindow(window *spec.MaintenanceWindow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windows = append(s.windows, window)
+}
+
+func (s *silencer) add(silence spec.Silence, duration time.Duration) *Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	added := &Silence{ID: strconv.Itoa(s.lastID), Silence: silence, Until: s.now().Add(duration)}
+	s.silences[added.ID] = added
+	s.save()
+	return added
+}
+
+func (s *silencer) expire(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.silences[id]; !ok {
+		return false
+	}
+	delete(s.silences, id)
+	s.save()
+	return true
+}
+
+// active returns the silences in effect, those of maintenance windows first.
+func (s *silencer) active() []*Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	active := []*Silence{}
+	for i, window := range s.windows {
+		if until, ok := window.Active(now); ok {
+			active = append(active, &Silence{
+				ID:       fmt.Sprintf("window#%d", i+1),
+				Silence:  window.Silence,
+				Until:    until,
+				Schedule: window.Schedule,
+			})
+		}
+	}
+	var added []*Silence
+	expired := false
+	for id, silence := range s.silences {
+		if !now.Before(silence.Until) {
+			delete(s.silences, id)
+			expired = true
+			continue
+		}
+		added = append(added, silence)
+	}
+	if expired {
+		s.save()
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].Until.Before(added[j].Until) })
+	return append(active, added...)
+}
+
+// silenced returns the silence of serviceName for scope that lasts the
+// longest.
+func (s *silencer) silenced(serviceName string, scope string) (*Silence, bool) {
+	var longest *Silence
+	for _, silence := range s.active() {
+		if silence.Matches(serviceName, scope) && (longest == nil || silence.Until.After(longest.Until)) {
+			longest = silence
+		}
+	}
+	return longest, longest != nil
+}
+
+// probingChanged records id as the silence serviceName is not probed for,
+// empty when it is probed. It returns the silence recorded before and whether
+// that changed.
+func (s *silencer) probingChanged(serviceName string, id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.probing[serviceName]
+	if id == "" {
+		delete(s.probing, serviceName)
+	} else {
+		s.probing[serviceName] = id
+	}
+	return previous, previous != id
+}
+
+// LoadSilences restores the silences added for a duration from path and
+// keeps them up to date there. It must be called before any service is
+// added.
+func (pm *ProberManager) LoadSilences(path string) error {
+	silences := newSilencer(path)
+	if err := silences.load(); err != nil {
+		return err
+	}
+	pm.silences = silences
+	return nil
+}
+
+// AddMaintenanceWindow silences the matching services every time the
+// schedule of window fires.
+func (pm *ProberManager) AddMaintenanceWindow(window *spec.MaintenanceWindow) error {
+	if err := window.Validate(); err != nil {
+		return err
+	}
+	pm.silences.addWindow(window)
+	return nil
+}
+
+// Silence silences the matching services for duration.
+func (pm *ProberManager) Silence(silence spec.Silence, duration time.Duration) (*Silence, error) {
+	if err := silence.Validate(); err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, errors.New("duration must be positive")
+	}
+	added := pm.silences.add(silence, duration)
+	log.Info().Str("services", added.Services).
+		Str("scope", added.Scope).
+		Str("id", added.ID).
+		Time("until", added.Until).
+		Str("comment", added.Comment).
+		Msg("silenced")
+	return added, nil
+}
+
+// Silences returns the silences in effect.
+func (pm *ProberManager) Silences() []*Silence {
+	return pm.silences.active()
+}
+
+// ExpireSilence ends the silence id before its time.
+func (pm *ProberManager) ExpireSilence(id string) error {
+	if !pm.silences.expire(id) {
+		return fmt.Errorf("unable to find the silence %s", id)
+	}
+	log.Info().Str("id", id).Msg("silence expired")
+	return nil
+}
+
+// probingSilenced reports whether the probes of the service are to be
+// skipped. It logs when such a silence starts and ends rather than on every
+// skipped probe.
+func (pm *ProberManager) probingSilenced(serviceName string) bool {
+	silence, ok := pm.silences.silenced(serviceName, "probing")
+	id := ""
+	if ok {
+		id = silence.ID
+	}
+	previous, changed := pm.silences.probingChanged(serviceName, id)
+	switch {
+	case changed && ok:
+		log.Info().Str("service_name", serviceName).
+			Str("reason", silence.reason()).
+			Msg("probing silenced")
+	case changed:
+		log.Info().Str("service_name", serviceName).
+			Str("id", previous).
+			Msg("probing resumed, silence ended")
+	}
+	return ok
+}
+
+// SilenceRequest is the body of a request adding a silence.
+type SilenceRequest struct {
+	spec.Silence
+	DurationSeconds int `json:"durationSeconds"`
+}
+
+// HandleSilences registers the silences API on mux:
+//
+//	GET /silences          lists the silences in effect
+//	POST /silences         adds a silence from a SilenceRequest
+//	DELETE /silences/{id}  expires a silence
+func (pm *ProberManager) HandleSilences(mux *http.ServeMux) {
+	mux.HandleFunc("GET /silences", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, pm.Silences())
+	})
+	mux.HandleFunc("POST /silences", func(w http.ResponseWriter, r *http.Request) {
+		var req SilenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid silence: %s", err), http.StatusBadRequest)
+			return
+		}
+		silence, err := pm.Silence(req.Silence, time.Duration(req.DurationSeconds)*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, silence)
+	})
+	mux.HandleFunc("DELETE /silences/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := pm.ExpireSilence(r.PathValue("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn().Err(err).Msg("unable to write the response")
+	}
+}
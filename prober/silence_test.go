@@ -0,0 +1,224 @@
+package prober
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glendsoza/sprobe/spec"
+	"github.com/glendsoza/sprobe/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  *spec.MaintenanceWindow
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			window: &spec.MaintenanceWindow{Silence: spec.Silence{Services: "web-*.service"}, Schedule: "0 2 * * SUN", DurationSeconds: 3600},
+		},
+		{
+			name:    "no services",
+			window:  &spec.MaintenanceWindow{Schedule: "@daily", DurationSeconds: 3600},
+			wantErr: "no services defined",
+		},
+		{
+			name:    "bad glob",
+			window:  &spec.MaintenanceWindow{Silence: spec.Silence{Services: "web-[.service"}, Schedule: "@daily", DurationSeconds: 3600},
+			wantErr: "invalid services glob",
+		},
+		{
+			name:    "bad scope",
+			window:  &spec.MaintenanceWindow{Silence: spec.Silence{Services: "web.service", Scope: "all"}, Schedule: "@daily", DurationSeconds: 3600},
+			wantErr: "scope must be remediation or probing",
+		},
+		{
+			name:    "bad schedule",
+			window:  &spec.MaintenanceWindow{Silence: spec.Silence{Services: "web.service"}, Schedule: "0 2 * *", DurationSeconds: 3600},
+			wantErr: "invalid schedule",
+		},
+		{
+			name:    "no duration",
+			window:  &spec.MaintenanceWindow{Silence: spec.Silence{Services: "web.service"}, Schedule: "@daily"},
+			wantErr: "durationSeconds must be positive",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.window.Validate()
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "remediation", test.window.Scope)
+		})
+	}
+
+	window := &spec.MaintenanceWindow{Silence: spec.Silence{Services: "web.service"}, Schedule: "0 2 * * SUN", DurationSeconds: 3600}
+	assert.NoError(t, window.Validate())
+	sunday := time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)
+	_, ok := window.Active(sunday.Add(time.Hour + 59*time.Minute))
+	assert.False(t, ok, "before the window")
+	until, ok := window.Active(sunday.Add(2 * time.Hour))
+	assert.True(t, ok, "as the window opens")
+	assert.Equal(t, sunday.Add(3*time.Hour), until)
+	_, ok = window.Active(sunday.Add(2*time.Hour + 59*time.Minute))
+	assert.True(t, ok, "within the window")
+	_, ok = window.Active(sunday.Add(3 * time.Hour))
+	assert.False(t, ok, "after the window")
+	_, ok = window.Active(sunday.Add(26 * time.Hour))
+	assert.False(t, ok, "on another day")
+}
+
+func TestSilencer(t *testing.T) {
+	now := time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)
+	s := newSilencer("")
+	s.now = func() time.Time { return now }
+
+	window := &spec.MaintenanceWindow{Silence: spec.Silence{Services: "db.service", Scope: "probing"}, Schedule: "@daily", DurationSeconds: 600}
+	assert.NoError(t, window.Validate())
+	s.addWindow(window)
+	deploy := s.add(spec.Silence{Services: "web-*.service", Scope: "remediation", Comment: "deploy"}, 10*time.Minute)
+
+	silence, ok := s.silenced("web-1.service", "remediation")
+	assert.True(t, ok)
+	assert.Equal(t, deploy.ID, silence.ID)
+	assert.Contains(t, silence.reason(), "deploy")
+	_, ok = s.silenced("web-1.service", "probing")
+	assert.False(t, ok, "silencing remediation keeps probing")
+	_, ok = s.silenced("api.service", "remediation")
+	assert.False(t, ok)
+	silence, ok = s.silenced("db.service", "remediation")
+	assert.True(t, ok, "silencing probing holds back remediation as well")
+	assert.Equal(t, "window#1", silence.ID)
+	assert.Len(t, s.active(), 2)
+
+	now = now.Add(10 * time.Minute)
+	assert.Empty(t, s.active())
+	_, ok = s.silenced("web-1.service", "remediation")
+	assert.False(t, ok, "expired")
+
+	deploy = s.add(spec.Silence{Services: "*", Scope: "remediation"}, time.Hour)
+	assert.True(t, s.expire(deploy.ID))
+	assert.False(t, s.expire(deploy.ID))
+	_, ok = s.silenced("web-1.service", "remediation")
+	assert.False(t, ok, "expired by hand")
+}
+
+func TestSilencerPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silences.json")
+	s := newSilencer(path)
+	deploy := s.add(spec.Silence{Services: "web-*.service", Scope: "remediation", Comment: "deploy"}, time.Hour)
+	expired := s.add(spec.Silence{Services: "db.service", Scope: "probing"}, time.Hour)
+	assert.True(t, s.expire(expired.ID))
+
+	restarted := newSilencer(path)
+	assert.NoError(t, restarted.load())
+	active := restarted.active()
+	assert.Len(t, active, 1)
+	assert.Equal(t, deploy.ID, active[0].ID)
+	assert.Equal(t, "deploy", active[0].Comment)
+	assert.Equal(t, "3", restarted.add(spec.Silence{Services: "*", Scope: "remediation"}, time.Hour).ID, "ids are not reused")
+
+	assert.NoError(t, newSilencer(filepath.Join(t.TempDir(), "missing.json")).load())
+}
+
+func TestProberManager_ProbingSilenced(t *testing.T) {
+	pm := newTestProberManager(nil)
+	silence, err := pm.Silence(spec.Silence{Services: "batch.service", Scope: "probing"}, time.Hour)
+	assert.NoError(t, err)
+
+	assert.True(t, pm.probingSilenced("batch.service"))
+	assert.Equal(t, silence.ID, pm.silences.probing["batch.service"], "the start was recorded")
+	assert.True(t, pm.probingSilenced("batch.service"))
+	_, changed := pm.silences.probingChanged("batch.service", silence.ID)
+	assert.False(t, changed, "logged once while the silence lasts")
+
+	assert.NoError(t, pm.ExpireSilence(silence.ID))
+	assert.False(t, pm.probingSilenced("batch.service"))
+	previous, changed := pm.silences.probingChanged("batch.service", "")
+	assert.False(t, changed, "the end was recorded")
+	assert.Empty(t, previous)
+}
+
+func TestProberManager_StopForgetsProbingSilence(t *testing.T) {
+	pm := newTestProberManager(&scriptedProber{statuses: map[string][]status.Status{}, calls: map[string]int{}})
+	_, err := pm.Silence(spec.Silence{Services: "batch.service", Scope: "probing"}, time.Hour)
+	assert.NoError(t, err)
+	liveness := &spec.Probe{
+		ProbeHandler:        spec.ProbeHandler{Exec: &spec.ExecProbe{Command: []string{"liveness"}}},
+		InitialDelaySeconds: spec.ToIntRef(0),
+		PeriodSeconds:       spec.ToIntRef(1),
+	}
+	testSpec := &spec.LivenessProbe{ServiceName: "batch.service", LivenessProbe: liveness}
+	assert.NoError(t, pm.Add(testSpec))
+	time.Sleep(1500 * time.Millisecond)
+	pm.silences.mu.Lock()
+	assert.Contains(t, pm.silences.probing, "batch.service")
+	pm.silences.mu.Unlock()
+
+	assert.NoError(t, pm.stopProbe(testSpec.ServiceName))
+	assert.NotContains(t, pm.silences.probing, "batch.service", "a service added again logs its silence anew")
+}
+
+func TestHandleSilences(t *testing.T) {
+	pm := newTestProberManager(nil)
+	mux := http.NewServeMux()
+	pm.HandleSilences(mux)
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/silences", `{"services":"web-*.service","durationSeconds":600,"comment":"deploy"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var added Silence
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &added))
+	assert.Equal(t, "web-*.service", added.Services)
+	assert.Equal(t, "remediation", added.Scope)
+
+	rec = do(http.MethodPost, "/silences", `{"services":"web.service"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "duration must be positive")
+	rec = do(http.MethodPost, "/silences", `{"services":"web.service","scope":"all","durationSeconds":600}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(http.MethodGet, "/silences", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var silences []*Silence
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &silences))
+	assert.Len(t, silences, 1)
+	assert.Equal(t, added.ID, silences[0].ID)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/silences/"+added.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/silences/"+added.ID, "").Code)
+	assert.JSONEq(t, "[]", do(http.MethodGet, "/silences", "").Body.String())
+}
+
+func TestProberManager_RemediationSilenced(t *testing.T) {
+	units := &DummyUnits{}
+	pm := newTestProberManager(nil)
+	pm.unitsManager = units
+	testSpec := &spec.LivenessProbe{ServiceName: "deployed.service", AutoRestart: spec.ToBoolRef(true)}
+	testSpec.Exec = &spec.ExecProbe{Command: []string{"true"}}
+	assert.NoError(t, testSpec.Validate())
+
+	silence, err := pm.Silence(spec.Silence{Services: "deployed.*"}, time.Hour)
+	assert.NoError(t, err)
+	pm.remediate(testSpec)
+	assert.Empty(t, units.recorded(), "remediation is held back while silenced")
+	assert.False(t, pm.probingSilenced(testSpec.ServiceName))
+
+	assert.NoError(t, pm.ExpireSilence(silence.ID))
+	pm.remediate(testSpec)
+	assert.Equal(t, []string{"restart deployed.service replace"}, units.recorded())
+}
@@ -1,89 +1,1377 @@
 package spec
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/sys/unix"
 )
 
 type ExecProbe struct {
 	Command []string `yaml:"command"`
+	Env     []EnvVar `yaml:"env,omitempty"`
+	// EnvFile is read before every probe and overridden by Env
+	EnvFile    string `yaml:"envFile,omitempty"`
+	WorkingDir string `yaml:"workingDir,omitempty"`
+	User       string `yaml:"user,omitempty"`
+	Group      string `yaml:"group,omitempty"`
+	// MaxOutputBytes caps the captured stdout and stderr
+	MaxOutputBytes *int `yaml:"maxOutputBytes,omitempty"`
+	// Output selects how the result is read: "exitCode" only distinguishes
+	// zero from non-zero, "nagios" follows the Nagios plugin API and "json"
+	// reads a probe.ExecJSONResult
+	Output string `yaml:"output,omitempty"`
+}
+
+type EnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+func (ep *ExecProbe) validate() error {
+	if len(ep.Command) == 0 {
+		return errors.New("exec probe must define a command")
+	}
+	for _, env := range ep.Env {
+		if env.Name == "" || strings.Contains(env.Name, "=") {
+			return fmt.Errorf("invalid exec env name %q", env.Name)
+		}
+	}
+	if ep.MaxOutputBytes == nil {
+		ep.MaxOutputBytes = ToIntRef(DefaultExecOutputLimit)
+	}
+	if *ep.MaxOutputBytes <= 0 {
+		return errors.New("exec maxOutputBytes must be positive")
+	}
+	switch ep.Output {
+	case "":
+		ep.Output = "exitCode"
+	case "exitCode", "nagios", "json":
+	default:
+		return fmt.Errorf("unsupported exec output %q; must be one of exitCode, nagios, json", ep.Output)
+	}
+	return nil
 }
 
+// DefaultExecOutputLimit caps the captured output of exec probes, as
+// Kubernetes does.
+const DefaultExecOutputLimit = 10 * 1024
+
 type HTTPGetProbe struct {
 	Path        string `yaml:"path"`
 	Port        int    `yaml:"port"`
+	SocketPath  string `yaml:"socketPath,omitempty"`
 	HTTPHeaders []struct {
 		Name  string `yaml:"name"`
 		Value string `yaml:"value"`
 	} `yaml:"httpHeaders,omitempty"`
 }
 
+type HTTPProbe struct {
+	URL         string `yaml:"url"`
+	Method      string `yaml:"method,omitempty"`
+	Body        string `yaml:"body,omitempty"`
+	SocketPath  string `yaml:"socketPath,omitempty"`
+	HTTPHeaders []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"httpHeaders,omitempty"`
+	// ExpectedStatusCodes accepts single codes ("204") and inclusive ranges
+	// ("200-299"). When empty 2xx is success and 3xx is a warning.
+	ExpectedStatusCodes []string            `yaml:"expectedStatusCodes,omitempty"`
+	BodyContains        []string            `yaml:"bodyContains,omitempty"`
+	BodyMatches         []string            `yaml:"bodyMatches,omitempty"`
+	JSONPath            []JSONPathAssertion `yaml:"jsonPath,omitempty"`
+	ResponseHeaders     []ResponseHeader    `yaml:"responseHeaders,omitempty"`
+	statusCodes         []StatusCodeRange
+	bodyMatches         []*regexp.Regexp
+}
+
+// StatusCodes returns ExpectedStatusCodes as parsed by Validate.
+func (hp *HTTPProbe) StatusCodes() []StatusCodeRange {
+	return hp.statusCodes
+}
+
+// BodyRegexps returns BodyMatches as compiled by Validate.
+func (hp *HTTPProbe) BodyRegexps() []*regexp.Regexp {
+	return hp.bodyMatches
+}
+
+// StatusCodeRange is an inclusive range of accepted HTTP status codes.
+type StatusCodeRange struct {
+	Min int
+	Max int
+}
+
+// ParseStatusCodeRange parses either a single code ("204") or an inclusive
+// range ("200-299").
+func ParseStatusCodeRange(s string) (StatusCodeRange, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return StatusCodeRange{}, fmt.Errorf("invalid status code %q", s)
+	}
+	max := min
+	if isRange {
+		max, err = strconv.Atoi(strings.TrimSpace(hi))
+		if err != nil {
+			return StatusCodeRange{}, fmt.Errorf("invalid status code range %q", s)
+		}
+	}
+	if min < 100 || max > 599 || min > max {
+		return StatusCodeRange{}, fmt.Errorf("invalid status code range %q", s)
+	}
+	return StatusCodeRange{Min: min, Max: max}, nil
+}
+
+// JSONPathAssertion requires the value at Path in a JSON response body to
+// equal Value.
+type JSONPathAssertion struct {
+	Path  string `yaml:"path"`
+	Value string `yaml:"value"`
+}
+
+// ResponseHeader requires a response header to be present, and to equal
+// Value when one is given.
+type ResponseHeader struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value,omitempty"`
+}
+
+func (hp *HTTPProbe) validate() error {
+	if hp.URL == "" {
+		return errors.New("http probe must define a url")
+	}
+	if hp.Method == "" {
+		hp.Method = "GET"
+	}
+	hp.Method = strings.ToUpper(hp.Method)
+	hp.statusCodes = nil
+	for _, code := range hp.ExpectedStatusCodes {
+		r, err := ParseStatusCodeRange(code)
+		if err != nil {
+			return err
+		}
+		hp.statusCodes = append(hp.statusCodes, r)
+	}
+	hp.bodyMatches = nil
+	for _, expr := range hp.BodyMatches {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid bodyMatches expression %q: %w", expr, err)
+		}
+		hp.bodyMatches = append(hp.bodyMatches, re)
+	}
+	for _, jp := range hp.JSONPath {
+		if jp.Path == "" {
+			return errors.New("jsonPath assertion must define a path")
+		}
+	}
+	return nil
+}
+
 type TCPSocketProbe struct {
-	Port int `yaml:"port"`
+	// Host defaults to localhost. A value of the form "unix:/path/to.sock"
+	// probes a Unix domain socket instead, in which case Port is ignored.
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port"`
+	// SocketType selects stream (default) or seqpacket Unix sockets.
+	SocketType string `yaml:"socketType,omitempty"`
+	// IPFamily restricts resolution of Host to ipv4 or ipv6.
+	IPFamily string    `yaml:"ipFamily,omitempty"`
+	Steps    []TCPStep `yaml:"steps,omitempty"`
 }
 
-type LivenessProbe struct {
-	ServiceName         string          `yaml:"serviceName"`
-	Exec                *ExecProbe      `yaml:"exec,omitempty"`
-	HTTPGet             *HTTPGetProbe   `yaml:"httpGet,omitempty"`
-	TCPSocket           *TCPSocketProbe `yaml:"tcpSocket,omitempty"`
-	InitialDelaySeconds *int            `yaml:"initialDelaySeconds"`
-	PeriodSeconds       *int            `yaml:"periodSeconds"`
-	TimeoutSeconds      *int            `yaml:"timeoutSeconds"`
-	FailureThreshold    *int            `yaml:"failureThreshold"`
-	SuccessThreshold    *int            `yaml:"successThreshold"`
-	AutoRestart         *bool           `yaml:"autoRestart"`
+// IsUnix reports whether the probe targets a Unix domain socket.
+func (tp *TCPSocketProbe) IsUnix() bool {
+	return strings.HasPrefix(tp.Host, "unix:")
 }
 
-func (lp *LivenessProbe) Validate() error {
-	if lp.ServiceName == "" {
-		return errors.New("no service name defined; must define the service name")
+// Network returns the net.Dial network and address for the probe.
+func (tp *TCPSocketProbe) Network() (string, string) {
+	if tp.IsUnix() {
+		path := strings.TrimPrefix(strings.TrimPrefix(tp.Host, "unix:"), "//")
+		if tp.SocketType == "seqpacket" {
+			return "unixpacket", path
+		}
+		return "unix", path
+	}
+	addr := net.JoinHostPort(tp.Host, strconv.Itoa(tp.Port))
+	switch tp.IPFamily {
+	case "ipv4":
+		return "tcp4", addr
+	case "ipv6":
+		return "tcp6", addr
+	}
+	return "tcp", addr
+}
+
+// TCPStep is one send/expect exchange run in order after the connection is
+// established. Send and SendHex are mutually exclusive, as are Expect and
+// ExpectRegex. Expect matches the start of the reply.
+type TCPStep struct {
+	Send           string `yaml:"send,omitempty"`
+	SendHex        string `yaml:"sendHex,omitempty"`
+	Expect         string `yaml:"expect,omitempty"`
+	ExpectRegex    string `yaml:"expectRegex,omitempty"`
+	TimeoutSeconds *int   `yaml:"timeoutSeconds,omitempty"`
+}
+
+func (tp *TCPSocketProbe) validate() error {
+	if tp.Host == "" {
+		tp.Host = "localhost"
+	}
+	if tp.IsUnix() {
+		if _, path := tp.Network(); path == "" {
+			return errors.New("tcpSocket unix host must include a socket path")
+		}
+		if tp.SocketType != "" && tp.SocketType != "stream" && tp.SocketType != "seqpacket" {
+			return fmt.Errorf("tcpSocket socketType must be stream or seqpacket, got %q", tp.SocketType)
+		}
+		if tp.IPFamily != "" {
+			return errors.New("tcpSocket ipFamily cannot be used with a unix socket")
+		}
+	} else {
+		if tp.SocketType != "" && tp.SocketType != "stream" {
+			return fmt.Errorf("tcpSocket socketType %q is only supported for unix sockets", tp.SocketType)
+		}
+		if tp.IPFamily != "" && tp.IPFamily != "ipv4" && tp.IPFamily != "ipv6" {
+			return fmt.Errorf("tcpSocket ipFamily must be ipv4 or ipv6, got %q", tp.IPFamily)
+		}
+	}
+	for i, step := range tp.Steps {
+		if step.Send != "" && step.SendHex != "" {
+			return fmt.Errorf("tcpSocket step %d: only one of send or sendHex can be defined", i+1)
+		}
+		if step.Expect != "" && step.ExpectRegex != "" {
+			return fmt.Errorf("tcpSocket step %d: only one of expect or expectRegex can be defined", i+1)
+		}
+		if _, err := hex.DecodeString(step.SendHex); err != nil {
+			return fmt.Errorf("tcpSocket step %d: invalid sendHex: %w", i+1, err)
+		}
+		if _, err := regexp.Compile(step.ExpectRegex); err != nil {
+			return fmt.Errorf("tcpSocket step %d: invalid expectRegex: %w", i+1, err)
+		}
+		if step.TimeoutSeconds != nil && *step.TimeoutSeconds <= 0 {
+			return fmt.Errorf("tcpSocket step %d: timeoutSeconds must be positive", i+1)
+		}
+	}
+	return nil
+}
+
+type TLSClientConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`
+	ServerName         string `yaml:"serverName,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+}
+
+type GRPCProbe struct {
+	Host     string           `yaml:"host,omitempty"`
+	Port     int              `yaml:"port"`
+	Service  string           `yaml:"service,omitempty"`
+	TLS      *TLSClientConfig `yaml:"tls,omitempty"`
+	Metadata []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"metadata,omitempty"`
+}
+
+type TLSProbe struct {
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port"`
+	// ServerName is sent as SNI and checked against the certificate; it
+	// defaults to Host.
+	ServerName        string `yaml:"serverName,omitempty"`
+	CAFile            string `yaml:"caFile,omitempty"`
+	ExpiryWarningDays *int   `yaml:"expiryWarningDays,omitempty"`
+}
+
+func (tp *TLSProbe) validate() error {
+	if tp.Host == "" {
+		tp.Host = "localhost"
+	}
+	if tp.ServerName == "" {
+		tp.ServerName = tp.Host
 	}
+	if tp.ExpiryWarningDays == nil {
+		tp.ExpiryWarningDays = ToIntRef(14)
+	}
+	if *tp.ExpiryWarningDays < 0 {
+		return errors.New("tls expiryWarningDays must not be negative")
+	}
+	return nil
+}
+
+// UnitProbe checks the systemd state of the monitored unit itself.
+type UnitProbe struct {
+	MaxActivatingSeconds *int `yaml:"maxActivatingSeconds,omitempty"`
+	// MaxRestarts fails the probe once systemd restarted the unit more than
+	// this many times within RestartWindowSeconds; zero disables the check.
+	MaxRestarts          int  `yaml:"maxRestarts,omitempty"`
+	RestartWindowSeconds *int `yaml:"restartWindowSeconds,omitempty"`
+}
+
+type Threshold struct {
+	Warning *float64 `yaml:"warning,omitempty"`
+	Failure *float64 `yaml:"failure,omitempty"`
+}
+
+func (t *Threshold) validate(name string) error {
+	if t == nil {
+		return nil
+	}
+	if t.Warning == nil && t.Failure == nil {
+		return fmt.Errorf("resources %s must define a warning or failure threshold", name)
+	}
+	if t.Warning != nil && t.Failure != nil && *t.Warning > *t.Failure {
+		return fmt.Errorf("resources %s warning threshold must not exceed the failure threshold", name)
+	}
+	return nil
+}
+
+// ResourcesProbe checks the resource usage of the unit's main process and
+// cgroup. MemoryPressure is the cgroup v2 "some avg10" PSI percentage.
+type ResourcesProbe struct {
+	RSSMegabytes   *Threshold `yaml:"rssMegabytes,omitempty"`
+	CPUPercent     *Threshold `yaml:"cpuPercent,omitempty"`
+	OpenFiles      *Threshold `yaml:"openFiles,omitempty"`
+	Threads        *Threshold `yaml:"threads,omitempty"`
+	MemoryPressure *Threshold `yaml:"memoryPressure,omitempty"`
+}
+
+func (rp *ResourcesProbe) validate() error {
+	thresholds := []struct {
+		name string
+		t    *Threshold
+	}{
+		{"rssMegabytes", rp.RSSMegabytes},
+		{"cpuPercent", rp.CPUPercent},
+		{"openFiles", rp.OpenFiles},
+		{"threads", rp.Threads},
+		{"memoryPressure", rp.MemoryPressure},
+	}
+	defined := 0
+	for _, th := range thresholds {
+		if th.t != nil {
+			defined++
+		}
+		if err := th.t.validate(th.name); err != nil {
+			return err
+		}
+	}
+	if defined == 0 {
+		return errors.New("resources probe must define at least one threshold")
+	}
+	return nil
+}
+
+// JournalProbe fails when the unit logs lines matching any of Patterns more
+// than MaxMatches times within WindowSeconds.
+type JournalProbe struct {
+	Patterns      []string `yaml:"patterns"`
+	MaxMatches    int      `yaml:"maxMatches,omitempty"`
+	WindowSeconds *int     `yaml:"windowSeconds,omitempty"`
+}
+
+func (jp *JournalProbe) validate() error {
+	if len(jp.Patterns) == 0 {
+		return errors.New("journal probe must define at least one pattern")
+	}
+	for _, expr := range jp.Patterns {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid journal pattern %q: %w", expr, err)
+		}
+	}
+	if jp.MaxMatches < 0 {
+		return errors.New("journal maxMatches must not be negative")
+	}
+	if jp.WindowSeconds == nil {
+		jp.WindowSeconds = ToIntRef(300)
+	}
+	if *jp.WindowSeconds <= 0 {
+		return errors.New("journal windowSeconds must be positive")
+	}
+	return nil
+}
+
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"PTR":   dnsmessage.TypePTR,
+	"SOA":   dnsmessage.TypeSOA,
+	"SRV":   dnsmessage.TypeSRV,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+var dnsRcodes = map[string]dnsmessage.RCode{
+	"NOERROR":  dnsmessage.RCodeSuccess,
+	"FORMERR":  dnsmessage.RCodeFormatError,
+	"SERVFAIL": dnsmessage.RCodeServerFailure,
+	"NXDOMAIN": dnsmessage.RCodeNameError,
+	"NOTIMP":   dnsmessage.RCodeNotImplemented,
+	"REFUSED":  dnsmessage.RCodeRefused,
+}
+
+// parseDNSType parses a record type such as "A" or "srv".
+func parseDNSType(s string) (dnsmessage.Type, error) {
+	t, ok := dnsTypes[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported DNS record type %q", s)
+	}
+	return t, nil
+}
+
+// parseDNSRcode parses a response code mnemonic such as "NOERROR" or
+// "nxdomain".
+func parseDNSRcode(s string) (dnsmessage.RCode, error) {
+	rcode, ok := dnsRcodes[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported DNS rcode %q", s)
+	}
+	return rcode, nil
+}
+
+// DNSProbe queries Server, the first nameserver of /etc/resolv.conf by
+// default, for Name and checks the response.
+type DNSProbe struct {
+	Server   string `yaml:"server,omitempty"`
+	Protocol string `yaml:"protocol,omitempty"`
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type,omitempty"`
+	Rcode    string `yaml:"rcode,omitempty"`
+	// ExpectAnswer defaults to true when Rcode is NOERROR
+	ExpectAnswer           *bool    `yaml:"expectAnswer,omitempty"`
+	ExpectedValues         []string `yaml:"expectedValues,omitempty"`
+	MaxLatencyMilliseconds int      `yaml:"maxLatencyMilliseconds,omitempty"`
+	qtype                  dnsmessage.Type
+	rcode                  dnsmessage.RCode
+}
+
+// QueryType returns Type as parsed by Validate.
+func (dp *DNSProbe) QueryType() dnsmessage.Type {
+	return dp.qtype
+}
+
+// ResponseCode returns Rcode as parsed by Validate.
+func (dp *DNSProbe) ResponseCode() dnsmessage.RCode {
+	return dp.rcode
+}
+
+func (dp *DNSProbe) validate() error {
+	if dp.Name == "" {
+		return errors.New("dns probe must define a name")
+	}
+	if dp.Server != "" {
+		if _, _, err := net.SplitHostPort(dp.Server); err != nil {
+			dp.Server = net.JoinHostPort(dp.Server, "53")
+		}
+	}
+	switch dp.Protocol {
+	case "":
+		dp.Protocol = "udp"
+	case "udp", "tcp":
+	default:
+		return fmt.Errorf("invalid dns protocol %q, must be udp or tcp", dp.Protocol)
+	}
+	if dp.Type == "" {
+		dp.Type = "A"
+	}
+	qtype, err := parseDNSType(dp.Type)
+	if err != nil {
+		return err
+	}
+	dp.qtype = qtype
+	if dp.Rcode == "" {
+		dp.Rcode = "NOERROR"
+	}
+	rcode, err := parseDNSRcode(dp.Rcode)
+	if err != nil {
+		return err
+	}
+	dp.rcode = rcode
+	if dp.ExpectAnswer == nil {
+		dp.ExpectAnswer = ToBoolRef(strings.EqualFold(dp.Rcode, "NOERROR"))
+	}
+	if dp.MaxLatencyMilliseconds < 0 {
+		return errors.New("dns maxLatencyMilliseconds must not be negative")
+	}
+	return nil
+}
+
+// UDPProbe sends Send or SendHex to Host:Port and, when Expect or ExpectRegex
+// is set, requires a matching reply within the probe timeout.
+type UDPProbe struct {
+	Host        string `yaml:"host,omitempty"`
+	Port        int    `yaml:"port"`
+	IPFamily    string `yaml:"ipFamily,omitempty"`
+	Send        string `yaml:"send,omitempty"`
+	SendHex     string `yaml:"sendHex,omitempty"`
+	Expect      string `yaml:"expect,omitempty"`
+	ExpectRegex string `yaml:"expectRegex,omitempty"`
+}
+
+// Network returns the net.Dial network and address for the probe.
+func (up *UDPProbe) Network() (string, string) {
+	addr := net.JoinHostPort(up.Host, strconv.Itoa(up.Port))
+	switch up.IPFamily {
+	case "ipv4":
+		return "udp4", addr
+	case "ipv6":
+		return "udp6", addr
+	}
+	return "udp", addr
+}
+
+func (up *UDPProbe) validate() error {
+	if up.Host == "" {
+		up.Host = "localhost"
+	}
+	if up.Port <= 0 || up.Port > 65535 {
+		return fmt.Errorf("udp port must be between 1 and 65535, got %d", up.Port)
+	}
+	if up.IPFamily != "" && up.IPFamily != "ipv4" && up.IPFamily != "ipv6" {
+		return fmt.Errorf("udp ipFamily must be ipv4 or ipv6, got %q", up.IPFamily)
+	}
+	if up.Send != "" && up.SendHex != "" {
+		return errors.New("udp probe can only define one of send or sendHex")
+	}
+	if up.Expect != "" && up.ExpectRegex != "" {
+		return errors.New("udp probe can only define one of expect or expectRegex")
+	}
+	if _, err := hex.DecodeString(up.SendHex); err != nil {
+		return fmt.Errorf("udp probe has an invalid sendHex: %w", err)
+	}
+	if _, err := regexp.Compile(up.ExpectRegex); err != nil {
+		return fmt.Errorf("udp probe has an invalid expectRegex: %w", err)
+	}
+	return nil
+}
+
+// PostgresProbe connects to a PostgreSQL server and runs SELECT 1. A Host
+// starting with "/" is the directory of the server's Unix socket.
+type PostgresProbe struct {
+	Host         string `yaml:"host,omitempty"`
+	Port         int    `yaml:"port,omitempty"`
+	User         string `yaml:"user"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"passwordFile,omitempty"`
+	Database     string `yaml:"database,omitempty"`
+	SSLMode      string `yaml:"sslMode,omitempty"`
+}
+
+func (pp *PostgresProbe) validate() error {
+	if pp.Host == "" {
+		pp.Host = "localhost"
+	}
+	if pp.Port == 0 {
+		pp.Port = 5432
+	}
+	if pp.User == "" {
+		return errors.New("postgres probe must define a user")
+	}
+	if pp.SSLMode == "" {
+		pp.SSLMode = "disable"
+	}
+	switch pp.SSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("postgres sslMode must be disable, require, verify-ca or verify-full, got %q", pp.SSLMode)
+	}
+	return validatePassword("postgres", pp.Password, pp.PasswordFile)
+}
+
+// MySQLProbe connects to a MySQL or MariaDB server and pings it.
+type MySQLProbe struct {
+	Host         string `yaml:"host,omitempty"`
+	Port         int    `yaml:"port,omitempty"`
+	SocketPath   string `yaml:"socketPath,omitempty"`
+	User         string `yaml:"user"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"passwordFile,omitempty"`
+	Database     string `yaml:"database,omitempty"`
+}
+
+func (mp *MySQLProbe) validate() error {
+	if mp.Host == "" {
+		mp.Host = "localhost"
+	}
+	if mp.Port == 0 {
+		mp.Port = 3306
+	}
+	if mp.User == "" {
+		return errors.New("mysql probe must define a user")
+	}
+	return validatePassword("mysql", mp.Password, mp.PasswordFile)
+}
+
+// RedisProbe sends PING to a Redis server and optionally checks the
+// replication role it reports.
+type RedisProbe struct {
+	Host         string `yaml:"host,omitempty"`
+	Port         int    `yaml:"port,omitempty"`
+	SocketPath   string `yaml:"socketPath,omitempty"`
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"passwordFile,omitempty"`
+	// ExpectedRole is master or replica
+	ExpectedRole string `yaml:"expectedRole,omitempty"`
+}
+
+// Network returns the net.Dial network and address for the probe.
+func (rp *RedisProbe) Network() (string, string) {
+	if rp.SocketPath != "" {
+		return "unix", rp.SocketPath
+	}
+	return "tcp", net.JoinHostPort(rp.Host, strconv.Itoa(rp.Port))
+}
+
+func (rp *RedisProbe) validate() error {
+	if rp.Host == "" {
+		rp.Host = "localhost"
+	}
+	if rp.Port == 0 {
+		rp.Port = 6379
+	}
+	switch rp.ExpectedRole {
+	case "", "master", "replica":
+	default:
+		return fmt.Errorf("redis expectedRole must be master or replica, got %q", rp.ExpectedRole)
+	}
+	if rp.Username != "" && rp.Password == "" && rp.PasswordFile == "" {
+		return errors.New("redis username requires a password or passwordFile")
+	}
+	return validatePassword("redis", rp.Password, rp.PasswordFile)
+}
+
+func validatePassword(probeName string, password string, passwordFile string) error {
+	if password != "" && passwordFile != "" {
+		return fmt.Errorf("%s probe can only define one of password or passwordFile", probeName)
+	}
+	return nil
+}
+
+// WebSocketProbe performs the upgrade handshake against URL and, when Send is
+// set, expects a reply matching Expect or ExpectRegex.
+type WebSocketProbe struct {
+	URL         string `yaml:"url"`
+	HTTPHeaders []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"httpHeaders,omitempty"`
+	TLS         *TLSClientConfig `yaml:"tls,omitempty"`
+	Send        string           `yaml:"send,omitempty"`
+	Expect      string           `yaml:"expect,omitempty"`
+	ExpectRegex string           `yaml:"expectRegex,omitempty"`
+}
+
+func (wp *WebSocketProbe) validate() error {
+	u, err := url.Parse(wp.URL)
+	if err != nil {
+		return fmt.Errorf("invalid websocket url: %w", err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("websocket url must use ws or wss, got %q", wp.URL)
+	}
+	if wp.Expect != "" && wp.ExpectRegex != "" {
+		return errors.New("websocket probe can only define one of expect or expectRegex")
+	}
+	if (wp.Expect != "" || wp.ExpectRegex != "") && wp.Send == "" {
+		return errors.New("websocket expect and expectRegex require send")
+	}
+	if _, err := regexp.Compile(wp.ExpectRegex); err != nil {
+		return fmt.Errorf("websocket probe has an invalid expectRegex: %w", err)
+	}
+	return nil
+}
+
+// FileProbe checks a file the service writes, such as a heartbeat or status
+// file. Without any condition the file only has to exist.
+type FileProbe struct {
+	Path          string `yaml:"path"`
+	MaxAgeSeconds int    `yaml:"maxAgeSeconds,omitempty"`
+	MinSizeBytes  int64  `yaml:"minSizeBytes,omitempty"`
+	MaxSizeBytes  int64  `yaml:"maxSizeBytes,omitempty"`
+	ContentRegex  string `yaml:"contentRegex,omitempty"`
+}
+
+func (fp *FileProbe) validate() error {
+	if fp.Path == "" {
+		return errors.New("file probe must define a path")
+	}
+	if fp.MaxAgeSeconds < 0 || fp.MinSizeBytes < 0 || fp.MaxSizeBytes < 0 {
+		return errors.New("file maxAgeSeconds, minSizeBytes and maxSizeBytes must not be negative")
+	}
+	if fp.MaxSizeBytes > 0 && fp.MinSizeBytes > fp.MaxSizeBytes {
+		return fmt.Errorf("file minSizeBytes %d is larger than maxSizeBytes %d", fp.MinSizeBytes, fp.MaxSizeBytes)
+	}
+	if _, err := regexp.Compile(fp.ContentRegex); err != nil {
+		return fmt.Errorf("file probe has an invalid contentRegex: %w", err)
+	}
+	return nil
+}
+
+// ProbeHandler defines how a service is probed; exactly one probe type must be
+// set.
+type ProbeHandler struct {
+	Exec      *ExecProbe      `yaml:"exec,omitempty"`
+	HTTPGet   *HTTPGetProbe   `yaml:"httpGet,omitempty"`
+	HTTP      *HTTPProbe      `yaml:"http,omitempty"`
+	TCPSocket *TCPSocketProbe `yaml:"tcpSocket,omitempty"`
+	GRPC      *GRPCProbe      `yaml:"grpc,omitempty"`
+	TLS       *TLSProbe       `yaml:"tls,omitempty"`
+	Unit      *UnitProbe      `yaml:"unit,omitempty"`
+	Resources *ResourcesProbe `yaml:"resources,omitempty"`
+	Journal   *JournalProbe   `yaml:"journal,omitempty"`
+	DNS       *DNSProbe       `yaml:"dns,omitempty"`
+	UDP       *UDPProbe       `yaml:"udp,omitempty"`
+	Postgres  *PostgresProbe  `yaml:"postgres,omitempty"`
+	MySQL     *MySQLProbe     `yaml:"mysql,omitempty"`
+	Redis     *RedisProbe     `yaml:"redis,omitempty"`
+	WebSocket *WebSocketProbe `yaml:"websocket,omitempty"`
+	File      *FileProbe      `yaml:"file,omitempty"`
+}
+
+func (ph *ProbeHandler) validate() error {
 	definedCount := 0
 
-	if lp.Exec != nil {
+	if ph.Exec != nil {
+		definedCount++
+		if err := ph.Exec.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.HTTPGet != nil {
+		definedCount++
+	}
+	if ph.HTTP != nil {
+		definedCount++
+		if err := ph.HTTP.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.TCPSocket != nil {
+		definedCount++
+		if err := ph.TCPSocket.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.GRPC != nil {
+		definedCount++
+		if ph.GRPC.Host == "" {
+			ph.GRPC.Host = "localhost"
+		}
+	}
+	if ph.TLS != nil {
+		definedCount++
+		if err := ph.TLS.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.Unit != nil {
+		definedCount++
+		if ph.Unit.MaxActivatingSeconds == nil {
+			ph.Unit.MaxActivatingSeconds = ToIntRef(0)
+		}
+		if ph.Unit.RestartWindowSeconds == nil {
+			ph.Unit.RestartWindowSeconds = ToIntRef(600)
+		}
+	}
+	if ph.Resources != nil {
+		definedCount++
+		if err := ph.Resources.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.Journal != nil {
+		definedCount++
+		if err := ph.Journal.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.DNS != nil {
+		definedCount++
+		if err := ph.DNS.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.UDP != nil {
 		definedCount++
+		if err := ph.UDP.validate(); err != nil {
+			return err
+		}
 	}
-	if lp.HTTPGet != nil {
+	if ph.Postgres != nil {
 		definedCount++
+		if err := ph.Postgres.validate(); err != nil {
+			return err
+		}
 	}
-	if lp.TCPSocket != nil {
+	if ph.MySQL != nil {
 		definedCount++
+		if err := ph.MySQL.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.Redis != nil {
+		definedCount++
+		if err := ph.Redis.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.WebSocket != nil {
+		definedCount++
+		if err := ph.WebSocket.validate(); err != nil {
+			return err
+		}
+	}
+	if ph.File != nil {
+		definedCount++
+		if err := ph.File.validate(); err != nil {
+			return err
+		}
 	}
 
 	if definedCount == 0 {
-		return errors.New("no liveness probe type defined; must define one of exec, httpGet, or tcpSocket")
+		return errors.New("no probe type defined; must define one of exec, httpGet, http, tcpSocket, grpc, tls, unit, resources, journal, dns, udp, postgres, mysql, redis, websocket, or file")
 	}
 	if definedCount > 1 {
-		return errors.New("only one liveness probe type can be defined; multiple found")
+		return errors.New("only one probe type can be defined; multiple found, use checks to combine them")
+	}
+	return nil
+}
+
+// Check is one entry of a composite probe. Name identifies its result and
+// defaults to the probe type and position, e.g. "http#1".
+type Check struct {
+	Name         string `yaml:"name,omitempty"`
+	ProbeHandler `yaml:",inline"`
+}
+
+// Type returns the yaml key of the probe type the handler defines.
+func (ph *ProbeHandler) Type() string {
+	types := []struct {
+		name    string
+		defined bool
+	}{
+		{"exec", ph.Exec != nil},
+		{"httpGet", ph.HTTPGet != nil},
+		{"http", ph.HTTP != nil},
+		{"tcpSocket", ph.TCPSocket != nil},
+		{"grpc", ph.GRPC != nil},
+		{"tls", ph.TLS != nil},
+		{"unit", ph.Unit != nil},
+		{"resources", ph.Resources != nil},
+		{"journal", ph.Journal != nil},
+		{"dns", ph.DNS != nil},
+		{"udp", ph.UDP != nil},
+		{"postgres", ph.Postgres != nil},
+		{"mysql", ph.MySQL != nil},
+		{"redis", ph.Redis != nil},
+		{"websocket", ph.WebSocket != nil},
+		{"file", ph.File != nil},
+	}
+	for _, t := range types {
+		if t.defined {
+			return t.name
+		}
 	}
+	return ""
+}
 
-	if lp.AutoRestart == nil {
-		lp.AutoRestart = ToBoolRef(false)
+// Probe is a probe type, or several combined through Checks, together with
+// the timing and thresholds it runs with.
+type Probe struct {
+	ProbeHandler `yaml:",inline"`
+	// Checks replaces the single probe type with several, combined according
+	// to Require or AtLeast.
+	Checks []*Check `yaml:"checks,omitempty"`
+	// Require is all (default) or any
+	Require             string `yaml:"require,omitempty"`
+	AtLeast             *int   `yaml:"atLeast,omitempty"`
+	InitialDelaySeconds *int   `yaml:"initialDelaySeconds"`
+	PeriodSeconds       *int   `yaml:"periodSeconds"`
+	TimeoutSeconds      *int   `yaml:"timeoutSeconds"`
+	FailureThreshold    *int   `yaml:"failureThreshold"`
+	SuccessThreshold    *int   `yaml:"successThreshold"`
+}
+
+// isDefined reports whether any field of the probe is set.
+func (p *Probe) isDefined() bool {
+	return p.Type() != "" || len(p.Checks) > 0 || p.Require != "" || p.AtLeast != nil ||
+		p.InitialDelaySeconds != nil || p.PeriodSeconds != nil || p.TimeoutSeconds != nil ||
+		p.FailureThreshold != nil || p.SuccessThreshold != nil
+}
+
+func (p *Probe) validate(defaultInitialDelaySeconds int) error {
+	if len(p.Checks) == 0 {
+		if p.Require != "" || p.AtLeast != nil {
+			return errors.New("require and atLeast can only be used with checks")
+		}
+		if err := p.ProbeHandler.validate(); err != nil {
+			return err
+		}
+	} else if err := p.validateChecks(); err != nil {
+		return err
+	}
+
+	if p.FailureThreshold == nil {
+		p.FailureThreshold = ToIntRef(1)
+	}
+
+	if p.SuccessThreshold == nil {
+		p.SuccessThreshold = ToIntRef(1)
+	}
+
+	if p.PeriodSeconds == nil {
+		p.PeriodSeconds = ToIntRef(30)
+	}
+
+	if p.TimeoutSeconds == nil {
+		p.TimeoutSeconds = ToIntRef(10)
+	}
+
+	if p.InitialDelaySeconds == nil {
+		p.InitialDelaySeconds = ToIntRef(defaultInitialDelaySeconds)
+	}
+
+	return nil
+}
+
+func (p *Probe) validateChecks() error {
+	if p.Type() != "" {
+		return fmt.Errorf("%s cannot be defined together with checks", p.Type())
+	}
+	names := map[string]bool{}
+	for i, check := range p.Checks {
+		if err := check.validate(); err != nil {
+			return fmt.Errorf("check %d: %w", i+1, err)
+		}
+		if check.Name == "" {
+			check.Name = fmt.Sprintf("%s#%d", check.Type(), i+1)
+		}
+		if names[check.Name] {
+			return fmt.Errorf("check %d: duplicate check name %q", i+1, check.Name)
+		}
+		names[check.Name] = true
+	}
+	if p.AtLeast != nil {
+		if p.Require != "" {
+			return errors.New("only one of require or atLeast can be defined")
+		}
+		if *p.AtLeast < 1 || *p.AtLeast > len(p.Checks) {
+			return fmt.Errorf("atLeast must be between 1 and the number of checks (%d), got %d", len(p.Checks), *p.AtLeast)
+		}
+		return nil
+	}
+	switch p.Require {
+	case "":
+		p.Require = "all"
+	case "all", "any":
+	default:
+		return fmt.Errorf("require must be all or any, got %q", p.Require)
+	}
+	return nil
+}
+
+// RequiredChecks returns how many checks must pass for the service to be
+// healthy.
+func (p *Probe) RequiredChecks() int {
+	switch {
+	case p.AtLeast != nil:
+		return *p.AtLeast
+	case p.Require == "any":
+		return 1
+	}
+	return len(p.Checks)
+}
+
+// LivenessProbe configures how a service is probed. The probe fields defined
+// inline are its liveness probe, equivalent to defining them under
+// LivenessProbe.
+type LivenessProbe struct {
+	ServiceName string `yaml:"serviceName"`
+	Probe       `yaml:",inline"`
+	// StartupProbe gates the liveness and readiness probes until it succeeds
+	StartupProbe *Probe `yaml:"startupProbe,omitempty"`
+	// LivenessProbe restarts the service, when AutoRestart is set, once it
+	// fails. It drives the reported health unless ReadinessProbe is set, and
+	// reports the service unhealthy once it fails in any case.
+	LivenessProbe *Probe `yaml:"livenessProbe,omitempty"`
+	// ReadinessProbe drives the reported health and never restarts the service
+	ReadinessProbe *Probe `yaml:"readinessProbe,omitempty"`
+	// AutoRestart is a shorthand for a Remediation with a single restart
+	AutoRestart *bool `yaml:"autoRestart"`
+	// Remediation is run in order once the liveness or startup probe fails
+	Remediation []*RemediationAction `yaml:"remediation,omitempty"`
+	// Escalation replaces Remediation with steps tried one after the other
+	// for as long as the service stays unhealthy
+	Escalation []*EscalationStep `yaml:"escalation,omitempty"`
+	// RestartPolicy limits how often Remediation or an escalation step is run
+	RestartPolicy *RestartPolicy `yaml:"restartPolicy,omitempty"`
+}
+
+// EscalationStep is a rung of an escalation ladder. Its actions are run for
+// up to Attempts failed cycles before the next step takes over, and each run
+// gives the service VerifySeconds to become healthy during which it is not
+// remediated again. The last step is repeated until the service recovers.
+type EscalationStep struct {
+	// Name identifies the step in logs and defaults to its actions, e.g.
+	// "kill+restart"
+	Name          string               `yaml:"name,omitempty"`
+	Actions       []*RemediationAction `yaml:"actions"`
+	Attempts      *int                 `yaml:"attempts"`
+	VerifySeconds *int                 `yaml:"verifySeconds"`
+}
+
+func (es *EscalationStep) validate(serviceName string) error {
+	if len(es.Actions) == 0 {
+		return errors.New("no actions defined")
+	}
+	var names []string
+	for i, action := range es.Actions {
+		if err := action.validate(serviceName); err != nil {
+			return fmt.Errorf("actions[%d]: %w", i, err)
+		}
+		names = append(names, action.Action)
+	}
+	if es.Name == "" {
+		es.Name = strings.Join(names, "+")
+	}
+	if es.Attempts == nil {
+		es.Attempts = ToIntRef(1)
+	}
+	if es.VerifySeconds == nil {
+		es.VerifySeconds = ToIntRef(0)
+	}
+	if *es.Attempts <= 0 {
+		return errors.New("attempts must be positive")
+	}
+	if *es.VerifySeconds < 0 {
+		return errors.New("verifySeconds must not be negative")
+	}
+	return nil
+}
+
+// Ladder returns the escalation steps of the service. Remediation is a single
+// step repeated on every failed cycle.
+func (lp *LivenessProbe) Ladder() []*EscalationStep {
+	if len(lp.Escalation) > 0 {
+		return lp.Escalation
+	}
+	if len(lp.Remediation) == 0 {
+		return nil
+	}
+	return []*EscalationStep{{
+		Name:          "remediation",
+		Actions:       lp.Remediation,
+		Attempts:      ToIntRef(1),
+		VerifySeconds: ToIntRef(0),
+	}}
+}
+
+// RemediationAction is one step of the remediation of an unhealthy service.
+type RemediationAction struct {
+	// Action is one of restart, reload, stop, start, kill, reset-failed,
+	// restart-dependencies or exec. restart-dependencies restarts the services
+	// listed in Requires= of Unit, or Dependencies when set.
+	Action string `yaml:"action"`
+	// Unit the action applies to, defaults to the probed service
+	Unit string `yaml:"unit,omitempty"`
+	// Mode is the systemd job mode of restart, reload, stop, start and
+	// restart-dependencies, e.g. isolate to start a target in place of the
+	// current one
+	Mode string `yaml:"mode,omitempty"`
+	// Signal is sent by kill to the processes selected by Who: main, control
+	// or all
+	Signal string `yaml:"signal,omitempty"`
+	Who    string `yaml:"who,omitempty"`
+	// Dependencies are the services restarted by restart-dependencies in
+	// place of those in Requires=
+	Dependencies []string `yaml:"dependencies,omitempty"`
+	// Command is run by exec with SPROBE_SERVICE_NAME set
+	Command        []string `yaml:"command,omitempty"`
+	TimeoutSeconds *int     `yaml:"timeoutSeconds"`
+}
+
+// ParseSignal parses a signal name such as "SIGQUIT" or "QUIT", or its number.
+func ParseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if signal := unix.SignalNum(name); signal != 0 {
+		return signal, nil
+	}
+	return 0, fmt.Errorf("unknown signal %q", s)
+}
+
+func (ra *RemediationAction) validate(serviceName string) error {
+	if ra.Unit == "" {
+		ra.Unit = serviceName
+	}
+	if ra.TimeoutSeconds == nil {
+		ra.TimeoutSeconds = ToIntRef(90)
+	}
+	if *ra.TimeoutSeconds <= 0 {
+		return errors.New("timeoutSeconds must be positive")
+	}
+	if ra.Action != "exec" && len(ra.Command) > 0 {
+		return errors.New("command can only be used with exec")
+	}
+	if ra.Action != "kill" && (ra.Signal != "" || ra.Who != "") {
+		return errors.New("signal and who can only be used with kill")
+	}
+	if ra.Action != "restart-dependencies" && len(ra.Dependencies) > 0 {
+		return errors.New("dependencies can only be used with restart-dependencies")
+	}
+	for _, dependency := range ra.Dependencies {
+		if !strings.HasSuffix(dependency, ".service") {
+			return fmt.Errorf("dependency %s is not a service", dependency)
+		}
+	}
+	switch ra.Action {
+	case "restart", "reload", "stop", "start", "restart-dependencies":
+		switch ra.Mode {
+		case "":
+			ra.Mode = "replace"
+		case "replace", "fail", "isolate", "ignore-dependencies", "ignore-requirements", "replace-irreversibly":
+		default:
+			return fmt.Errorf("unsupported job mode %q", ra.Mode)
+		}
+		// systemd isolates units only when starting them
+		if ra.Mode == "isolate" && ra.Action != "start" {
+			return fmt.Errorf("mode isolate can only be used with start, not %s", ra.Action)
+		}
+		return nil
+	case "kill":
+		if ra.Signal == "" {
+			ra.Signal = "SIGTERM"
+		}
+		if _, err := ParseSignal(ra.Signal); err != nil {
+			return err
+		}
+		switch ra.Who {
+		case "":
+			ra.Who = "all"
+		case "main", "control", "all":
+		default:
+			return fmt.Errorf("who must be main, control or all, got %q", ra.Who)
+		}
+	case "reset-failed":
+	case "exec":
+		if len(ra.Command) == 0 {
+			return errors.New("exec must define a command")
+		}
+	default:
+		return fmt.Errorf("unsupported action %q; must be one of restart, reload, stop, start, kill, reset-failed, restart-dependencies, exec", ra.Action)
+	}
+	if ra.Mode != "" {
+		return fmt.Errorf("mode cannot be used with %s", ra.Action)
+	}
+	return nil
+}
+
+// RestartPolicy spaces consecutive restarts of a service by an exponential
+// backoff and gives up once MaxRestarts restarts happened within
+// WindowSeconds. A service that was given up on is not restarted again until
+// it is seen healthy, e.g. after it was fixed by hand.
+type RestartPolicy struct {
+	// BackoffSeconds is the minimum time between the first and second of
+	// consecutive restarts and doubles with every further restart
+	BackoffSeconds    *int `yaml:"backoffSeconds"`
+	MaxBackoffSeconds *int `yaml:"maxBackoffSeconds"`
+	// MaxRestarts of zero never gives up
+	MaxRestarts   *int `yaml:"maxRestarts"`
+	WindowSeconds *int `yaml:"windowSeconds"`
+}
+
+func (rp *RestartPolicy) validate() error {
+	if rp.BackoffSeconds == nil {
+		rp.BackoffSeconds = ToIntRef(10)
+	}
+	if rp.MaxBackoffSeconds == nil {
+		rp.MaxBackoffSeconds = ToIntRef(max(300, *rp.BackoffSeconds))
+	}
+	if rp.MaxRestarts == nil {
+		rp.MaxRestarts = ToIntRef(5)
+	}
+	if rp.WindowSeconds == nil {
+		rp.WindowSeconds = ToIntRef(3600)
+	}
+	if *rp.BackoffSeconds < 0 || *rp.MaxRestarts < 0 || *rp.WindowSeconds < 0 {
+		return errors.New("backoffSeconds, maxRestarts and windowSeconds must not be negative")
 	}
+	if *rp.MaxBackoffSeconds < *rp.BackoffSeconds {
+		return fmt.Errorf("maxBackoffSeconds %d is smaller than backoffSeconds %d", *rp.MaxBackoffSeconds, *rp.BackoffSeconds)
+	}
+	if *rp.MaxRestarts > 0 && *rp.WindowSeconds == 0 {
+		return errors.New("windowSeconds must be positive when maxRestarts is set")
+	}
+	return nil
+}
 
-	if lp.FailureThreshold == nil {
-		lp.FailureThreshold = ToIntRef(1)
+func (lp *LivenessProbe) Validate() error {
+	if lp.ServiceName == "" {
+		return errors.New("no service name defined; must define the service name")
+	}
+	if lp.Probe.isDefined() || (lp.StartupProbe == nil && lp.LivenessProbe == nil && lp.ReadinessProbe == nil) {
+		if lp.LivenessProbe != nil && lp.LivenessProbe != &lp.Probe {
+			return errors.New("the liveness probe must be defined either inline or under livenessProbe, not both")
+		}
+		lp.LivenessProbe = &lp.Probe
+	}
+	if lp.LivenessProbe == nil && lp.ReadinessProbe == nil {
+		return errors.New("startupProbe requires a livenessProbe or readinessProbe")
 	}
 
-	if lp.SuccessThreshold == nil {
-		lp.SuccessThreshold = ToIntRef(1)
+	// a startup probe already waits for the service to come up
+	initialDelaySeconds := 10
+	if lp.StartupProbe != nil {
+		if err := lp.StartupProbe.validate(initialDelaySeconds); err != nil {
+			return fmt.Errorf("startupProbe: %w", err)
+		}
+		initialDelaySeconds = 0
+	}
+	if lp.LivenessProbe != nil {
+		if err := lp.LivenessProbe.validate(initialDelaySeconds); err != nil {
+			if lp.LivenessProbe == &lp.Probe {
+				return err
+			}
+			return fmt.Errorf("livenessProbe: %w", err)
+		}
+	}
+	if lp.ReadinessProbe != nil {
+		if err := lp.ReadinessProbe.validate(initialDelaySeconds); err != nil {
+			return fmt.Errorf("readinessProbe: %w", err)
+		}
 	}
 
-	if lp.PeriodSeconds == nil {
-		lp.PeriodSeconds = ToIntRef(30)
+	if lp.AutoRestart == nil {
+		lp.AutoRestart = ToBoolRef(false)
+	}
+	// a single restart is what autoRestart expands to
+	if *lp.AutoRestart && (len(lp.Remediation) != 1 || lp.Remediation[0].Action != "restart") {
+		if len(lp.Remediation) > 0 {
+			return errors.New("autoRestart and remediation are exclusive; add a restart action to remediation instead")
+		}
+		lp.Remediation = []*RemediationAction{{Action: "restart"}}
+	}
+	for i, action := range lp.Remediation {
+		if err := action.validate(lp.ServiceName); err != nil {
+			return fmt.Errorf("remediation[%d]: %w", i, err)
+		}
+	}
+	if len(lp.Escalation) > 0 && len(lp.Remediation) > 0 {
+		return errors.New("escalation cannot be combined with remediation or autoRestart")
 	}
+	for i, step := range lp.Escalation {
+		if err := step.validate(lp.ServiceName); err != nil {
+			return fmt.Errorf("escalation[%d]: %w", i, err)
+		}
+	}
+	if lp.RestartPolicy == nil {
+		lp.RestartPolicy = &RestartPolicy{}
+	}
+	if err := lp.RestartPolicy.validate(); err != nil {
+		return fmt.Errorf("restartPolicy: %w", err)
+	}
+
+	return nil
+}
 
-	if lp.TimeoutSeconds == nil {
-		lp.TimeoutSeconds = ToIntRef(10)
+// Silence holds back the remediation of the services matching Services, a
+// glob such as "web-*.service". With Scope probing the services are not
+// probed either, otherwise their health keeps being recorded.
+type Silence struct {
+	Services string `yaml:"services" json:"services"`
+	// Scope is remediation or probing
+	Scope   string `yaml:"scope,omitempty" json:"scope"`
+	Comment string `yaml:"comment,omitempty" json:"comment,omitempty"`
+}
+
+func (s *Silence) Validate() error {
+	if s.Services == "" {
+		return errors.New("no services defined; must define a service name or glob")
+	}
+	if _, err := path.Match(s.Services, ""); err != nil {
+		return fmt.Errorf("invalid services glob %q: %w", s.Services, err)
 	}
+	switch s.Scope {
+	case "":
+		s.Scope = "remediation"
+	case "remediation", "probing":
+	default:
+		return fmt.Errorf("scope must be remediation or probing, got %q", s.Scope)
+	}
+	return nil
+}
 
-	if lp.InitialDelaySeconds == nil {
-		lp.InitialDelaySeconds = ToIntRef(10)
+// Matches reports whether serviceName is silenced for scope. A silence of
+// probing covers remediation as well.
+func (s *Silence) Matches(serviceName string, scope string) bool {
+	if scope == "probing" && s.Scope != "probing" {
+		return false
 	}
+	matched, _ := path.Match(s.Services, serviceName)
+	return matched
+}
 
+// MaintenanceWindow is a Silence recurring on a cron schedule, lasting
+// DurationSeconds from every time the schedule fires.
+type MaintenanceWindow struct {
+	Silence `yaml:",inline"`
+	// Schedule has the five fields of crontab, e.g. "0 2 * * SUN", or is a
+	// descriptor such as "@daily"
+	Schedule        string `yaml:"schedule"`
+	DurationSeconds int    `yaml:"durationSeconds"`
+	schedule        cron.Schedule
+}
+
+func (mw *MaintenanceWindow) Validate() error {
+	if err := mw.Silence.Validate(); err != nil {
+		return err
+	}
+	schedule, err := cron.ParseStandard(mw.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", mw.Schedule, err)
+	}
+	mw.schedule = schedule
+	if mw.DurationSeconds <= 0 {
+		return errors.New("durationSeconds must be positive")
+	}
 	return nil
 }
 
+// Active returns when the window that is open at now ends. It returns false
+// when no window is open.
+func (mw *MaintenanceWindow) Active(now time.Time) (time.Time, bool) {
+	duration := time.Duration(mw.DurationSeconds) * time.Second
+	// the last start within duration before now is the first one after
+	// now-duration
+	start := mw.schedule.Next(now.Add(-duration))
+	if start.IsZero() || start.After(now) {
+		return time.Time{}, false
+	}
+	return start.Add(duration), true
+}
+
 func ToBoolRef(b bool) *bool {
 	return &b
 }
@@ -0,0 +1,182 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatusCodeRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected StatusCodeRange
+		hasError bool
+	}{
+		{"200", StatusCodeRange{Min: 200, Max: 200}, false},
+		{"200-299", StatusCodeRange{Min: 200, Max: 299}, false},
+		{" 301 - 308 ", StatusCodeRange{Min: 301, Max: 308}, false},
+		{"299-200", StatusCodeRange{}, true},
+		{"abc", StatusCodeRange{}, true},
+		{"200-", StatusCodeRange{}, true},
+		{"99", StatusCodeRange{}, true},
+	}
+	for _, tt := range tests {
+		r, err := ParseStatusCodeRange(tt.input)
+		if tt.hasError {
+			assert.Error(t, err, tt.input)
+			continue
+		}
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, r)
+	}
+}
+
+func TestChecksValidation(t *testing.T) {
+	testSpec := &LivenessProbe{
+		ServiceName: "test.service",
+		Probe: Probe{
+			ProbeHandler: ProbeHandler{Exec: &ExecProbe{Command: []string{"true"}}},
+			Require:      "any",
+		},
+	}
+	assert.Error(t, testSpec.Validate())
+
+	testSpec.Checks = []*Check{{ProbeHandler: ProbeHandler{UDP: &UDPProbe{Port: 53}}}}
+	assert.Error(t, testSpec.Validate(), "a probe type cannot be combined with checks")
+
+	testSpec.Exec = nil
+	assert.NoError(t, testSpec.Validate())
+	testSpec.AtLeast = ToIntRef(1)
+	assert.Error(t, testSpec.Validate(), "require and atLeast are exclusive")
+	testSpec.Require = ""
+	testSpec.AtLeast = ToIntRef(2)
+	assert.Error(t, testSpec.Validate(), "atLeast exceeds the number of checks")
+
+	testSpec.AtLeast = nil
+	testSpec.Checks = append(testSpec.Checks, &Check{})
+	assert.Error(t, testSpec.Validate(), "a check without a probe type")
+	testSpec.Checks[1] = &Check{Name: "udp#1", ProbeHandler: ProbeHandler{UDP: &UDPProbe{Port: 54}}}
+	assert.Error(t, testSpec.Validate(), "duplicate check names")
+}
+
+func TestProbeKindsValidation(t *testing.T) {
+	exec := ProbeHandler{Exec: &ExecProbe{Command: []string{"true"}}}
+	testSpec := &LivenessProbe{ServiceName: "test.service", Probe: Probe{ProbeHandler: exec}}
+	assert.NoError(t, testSpec.Validate())
+	assert.Same(t, &testSpec.Probe, testSpec.LivenessProbe)
+	assert.Equal(t, 10, *testSpec.LivenessProbe.InitialDelaySeconds)
+	assert.NoError(t, testSpec.Validate(), "validating twice keeps the inline liveness probe")
+
+	testSpec.LivenessProbe = &Probe{ProbeHandler: exec}
+	assert.Error(t, testSpec.Validate(), "inline and livenessProbe are exclusive")
+
+	testSpec = &LivenessProbe{ServiceName: "test.service", StartupProbe: &Probe{ProbeHandler: exec}}
+	assert.Error(t, testSpec.Validate(), "a startup probe alone")
+
+	testSpec.ReadinessProbe = &Probe{ProbeHandler: exec}
+	assert.NoError(t, testSpec.Validate())
+	assert.Nil(t, testSpec.LivenessProbe)
+	assert.Equal(t, 10, *testSpec.StartupProbe.InitialDelaySeconds)
+	assert.Equal(t, 0, *testSpec.ReadinessProbe.InitialDelaySeconds, "the startup probe replaces the initial delay")
+
+	testSpec.ReadinessProbe = &Probe{}
+	assert.ErrorContains(t, testSpec.Validate(), "readinessProbe: no probe type defined")
+}
+
+func TestRemediationValidation(t *testing.T) {
+	newSpec := func(autoRestart bool, actions ...*RemediationAction) *LivenessProbe {
+		testSpec := &LivenessProbe{ServiceName: "app.service", AutoRestart: ToBoolRef(autoRestart), Remediation: actions}
+		testSpec.Exec = &ExecProbe{Command: []string{"true"}}
+		return testSpec
+	}
+	testSpec := newSpec(true)
+	assert.NoError(t, testSpec.Validate())
+	assert.NoError(t, testSpec.Validate(), "validating twice keeps the expanded autoRestart")
+	assert.Len(t, testSpec.Remediation, 1)
+	assert.Equal(t, RemediationAction{Action: "restart", Unit: "app.service", Mode: "replace", TimeoutSeconds: ToIntRef(90)}, *testSpec.Remediation[0])
+
+	testSpec = newSpec(false, &RemediationAction{Action: "kill"})
+	assert.NoError(t, testSpec.Validate())
+	assert.Equal(t, "SIGTERM", testSpec.Remediation[0].Signal)
+	assert.Equal(t, "all", testSpec.Remediation[0].Who)
+
+	testSpec = newSpec(false, &RemediationAction{Action: "start", Unit: "rescue.target", Mode: "isolate"})
+	assert.NoError(t, testSpec.Validate())
+
+	testCases := []struct {
+		name          string
+		spec          *LivenessProbe
+		expectedError string
+	}{
+		{"autoRestart with remediation", newSpec(true, &RemediationAction{Action: "reload"}), "autoRestart and remediation are exclusive"},
+		{"unknown action", newSpec(false, &RemediationAction{Action: "reboot"}), "remediation[0]: unsupported action"},
+		{"unknown signal", newSpec(false, &RemediationAction{Action: "kill", Signal: "SIGNOPE"}), `unknown signal "SIGNOPE"`},
+		{"unknown who", newSpec(false, &RemediationAction{Action: "kill", Who: "children"}), "who must be main, control or all"},
+		{"mode on kill", newSpec(false, &RemediationAction{Action: "kill", Mode: "fail"}), "mode cannot be used with kill"},
+		{"unknown mode", newSpec(false, &RemediationAction{Action: "restart", Mode: "now"}), "unsupported job mode"},
+		{"isolate on restart", newSpec(false, &RemediationAction{Action: "restart", Mode: "isolate"}), "mode isolate can only be used with start"},
+		{"isolate on restart-dependencies", newSpec(false, &RemediationAction{Action: "restart-dependencies", Mode: "isolate"}), "mode isolate can only be used with start"},
+		{"dependencies on restart", newSpec(false, &RemediationAction{Action: "restart", Dependencies: []string{"db.service"}}), "dependencies can only be used with restart-dependencies"},
+		{"dependency that is not a service", newSpec(false, &RemediationAction{Action: "restart-dependencies", Dependencies: []string{"system.slice"}}), "dependency system.slice is not a service"},
+		{"exec without command", newSpec(false, &RemediationAction{Action: "exec"}), "exec must define a command"},
+		{"command on restart", newSpec(false, &RemediationAction{Action: "restart", Command: []string{"true"}}), "command can only be used with exec"},
+	}
+	escalation := newSpec(true)
+	escalation.Escalation = []*EscalationStep{{Actions: []*RemediationAction{{Action: "reload"}}}}
+	noActions := newSpec(false)
+	noActions.Escalation = []*EscalationStep{{Name: "empty"}}
+	badAttempts := newSpec(false)
+	badAttempts.Escalation = []*EscalationStep{{Actions: []*RemediationAction{{Action: "reload"}}, Attempts: ToIntRef(0)}}
+	badAction := newSpec(false)
+	badAction.Escalation = []*EscalationStep{{Actions: []*RemediationAction{{Action: "reload"}}}, {Actions: []*RemediationAction{{Action: "reboot"}}}}
+	testCases = append(testCases, []struct {
+		name          string
+		spec          *LivenessProbe
+		expectedError string
+	}{
+		{"escalation with autoRestart", escalation, "escalation cannot be combined with remediation or autoRestart"},
+		{"escalation without actions", noActions, "escalation[0]: no actions defined"},
+		{"escalation attempts", badAttempts, "escalation[0]: attempts must be positive"},
+		{"escalation action", badAction, "escalation[1]: actions[0]: unsupported action"},
+	}...)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.ErrorContains(tt, tc.spec.Validate(), tc.expectedError)
+		})
+	}
+}
+
+func TestTLSProbeValidation(t *testing.T) {
+	tp := &TLSProbe{Port: 443}
+	assert.NoError(t, tp.validate())
+	assert.Equal(t, "localhost", tp.ServerName)
+	assert.Equal(t, 14, *tp.ExpiryWarningDays)
+
+	tp.ExpiryWarningDays = ToIntRef(-1)
+	assert.ErrorContains(t, tp.validate(), "expiryWarningDays must not be negative")
+}
+
+func TestTCPSocketProbeValidation(t *testing.T) {
+	tp := &TCPSocketProbe{Port: 25, Steps: []TCPStep{{Expect: "220", TimeoutSeconds: ToIntRef(2)}}}
+	assert.NoError(t, tp.validate())
+
+	tp.Steps = append(tp.Steps, TCPStep{Send: "QUIT\r\n", TimeoutSeconds: ToIntRef(-1)})
+	assert.ErrorContains(t, tp.validate(), "tcpSocket step 2: timeoutSeconds must be positive")
+}
+
+func TestJournalProbeValidation(t *testing.T) {
+	jp := &JournalProbe{Patterns: []string{"segfault"}}
+	assert.NoError(t, jp.validate())
+	assert.Equal(t, 300, *jp.WindowSeconds)
+
+	jp.WindowSeconds = ToIntRef(0)
+	assert.ErrorContains(t, jp.validate(), "journal windowSeconds must be positive")
+}
+
+func TestRedisProbeValidation(t *testing.T) {
+	rp := &RedisProbe{Username: "probe", PasswordFile: "/etc/sprobe/redis.pass"}
+	assert.NoError(t, rp.validate())
+
+	rp.PasswordFile = ""
+	assert.ErrorContains(t, rp.validate(), "redis username requires a password or passwordFile")
+}
@@ -3,6 +3,9 @@ package sysd
 import (
 	"context"
 	"fmt"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/coreos/go-systemd/v22/dbus"
 )
@@ -10,11 +13,44 @@ import (
 type SysdConn interface {
 	ListUnitsContext(context.Context) ([]dbus.UnitStatus, error)
 	RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	ReloadUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	KillUnitWithTarget(ctx context.Context, name string, target dbus.Who, signal int32) error
+	ResetFailedUnitContext(ctx context.Context, name string) error
+	GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]interface{}, error)
+	GetUnitTypePropertiesContext(ctx context.Context, unit string, unitType string) (map[string]interface{}, error)
 }
 
+// Units manages systemd units. The job methods queue a job with the given
+// mode, e.g. "replace", and wait up to timeout for its result.
 type Units interface {
 	Exists(serviceName string) (bool, error)
-	Restart(serviceName string) (string, error)
+	Restart(unitName string, mode string, timeout time.Duration) (string, error)
+	Reload(unitName string, mode string, timeout time.Duration) (string, error)
+	Start(unitName string, mode string, timeout time.Duration) (string, error)
+	Stop(unitName string, mode string, timeout time.Duration) (string, error)
+	// Kill sends signal to the "main" or "control" process of the unit or to
+	// "all" of its processes
+	Kill(unitName string, who string, signal syscall.Signal, timeout time.Duration) error
+	ResetFailed(unitName string, timeout time.Duration) error
+	State(unitName string) (*UnitState, error)
+}
+
+// UnitState is a snapshot of the D-Bus properties sprobe cares about. The
+// service specific fields are left zero for units that are not services.
+type UnitState struct {
+	Name                 string
+	ActiveState          string
+	SubState             string
+	StateChangeTimestamp time.Time
+	// Requires are the units listed in Requires=
+	Requires       []string
+	Result         string
+	NRestarts      uint32
+	ExecMainStatus int32
+	MainPID        uint32
+	ControlGroup   string
 }
 
 type SysdManager struct {
@@ -42,11 +78,81 @@ func (s *SysdManager) Exists(serviceName string) (bool, error) {
 	return false, fmt.Errorf("unable to find unit with name %s", serviceName)
 }
 
-func (s *SysdManager) Restart(serviceName string) (string, error) {
-	outputChan := make(chan string)
-	_, err := s.conn.RestartUnitContext(context.Background(), serviceName, "replace", outputChan)
-	if err != nil {
+func (s *SysdManager) Restart(unitName string, mode string, timeout time.Duration) (string, error) {
+	return runJob(s.conn.RestartUnitContext, unitName, mode, timeout)
+}
+
+func (s *SysdManager) Reload(unitName string, mode string, timeout time.Duration) (string, error) {
+	return runJob(s.conn.ReloadUnitContext, unitName, mode, timeout)
+}
+
+func (s *SysdManager) Start(unitName string, mode string, timeout time.Duration) (string, error) {
+	return runJob(s.conn.StartUnitContext, unitName, mode, timeout)
+}
+
+func (s *SysdManager) Stop(unitName string, mode string, timeout time.Duration) (string, error) {
+	return runJob(s.conn.StopUnitContext, unitName, mode, timeout)
+}
+
+func (s *SysdManager) Kill(unitName string, who string, signal syscall.Signal, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.conn.KillUnitWithTarget(ctx, unitName, dbus.Who(who), int32(signal))
+}
+
+func (s *SysdManager) ResetFailed(unitName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.conn.ResetFailedUnitContext(ctx, unitName)
+}
+
+type jobFunc func(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+
+// runJob queues a job and waits for its result. Results other than "done",
+// i.e. "canceled", "timeout", "failed", "dependency" or "skipped", are
+// returned as errors along with the result. The channel is buffered so that a
+// result arriving after the timeout does not block the D-Bus signal handler.
+func runJob(queue jobFunc, unitName string, mode string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	outputChan := make(chan string, 1)
+	if _, err := queue(ctx, unitName, mode, outputChan); err != nil {
 		return "", err
 	}
-	return <-outputChan, nil
+	select {
+	case result := <-outputChan:
+		if result != "done" {
+			return result, fmt.Errorf("job for %s finished with result %q", unitName, result)
+		}
+		return result, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("no result for the job of %s within %v", unitName, timeout)
+	}
+}
+
+func (s *SysdManager) State(unitName string) (*UnitState, error) {
+	props, err := s.conn.GetUnitPropertiesContext(context.Background(), unitName)
+	if err != nil {
+		return nil, err
+	}
+	state := &UnitState{Name: unitName}
+	state.ActiveState, _ = props["ActiveState"].(string)
+	state.SubState, _ = props["SubState"].(string)
+	state.Requires, _ = props["Requires"].([]string)
+	if usec, ok := props["StateChangeTimestamp"].(uint64); ok && usec > 0 {
+		state.StateChangeTimestamp = time.UnixMicro(int64(usec))
+	}
+	if !strings.HasSuffix(unitName, ".service") {
+		return state, nil
+	}
+	props, err = s.conn.GetUnitTypePropertiesContext(context.Background(), unitName, "Service")
+	if err != nil {
+		return nil, err
+	}
+	state.Result, _ = props["Result"].(string)
+	state.NRestarts, _ = props["NRestarts"].(uint32)
+	state.ExecMainStatus, _ = props["ExecMainStatus"].(int32)
+	state.MainPID, _ = props["MainPID"].(uint32)
+	state.ControlGroup, _ = props["ControlGroup"].(string)
+	return state, nil
 }
@@ -3,7 +3,9 @@ package sysd
 import (
 	"context"
 	"fmt"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-systemd/v22/dbus"
 	"github.com/stretchr/testify/assert"
@@ -12,10 +14,48 @@ import (
 var dummyError error = fmt.Errorf("this is dummy error")
 
 type MockSysdConn struct {
-	unitStatus   []dbus.UnitStatus
-	code         int
-	error        error
-	outputString string
+	unitStatus     []dbus.UnitStatus
+	code           int
+	error          error
+	outputString   string
+	unitProps      map[string]interface{}
+	unitTypeProps  map[string]interface{}
+	unitTypeCalled bool
+	// noResult leaves jobs without a result
+	noResult bool
+	calls    []string
+}
+
+func (msc *MockSysdConn) job(call string, ch chan<- string) (int, error) {
+	msc.calls = append(msc.calls, call)
+	if !msc.noResult {
+		go func() {
+			ch <- msc.outputString
+		}()
+	}
+	return msc.code, msc.error
+}
+
+func (msc *MockSysdConn) ReloadUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return msc.job("reload "+name+" "+mode, ch)
+}
+
+func (msc *MockSysdConn) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return msc.job("start "+name+" "+mode, ch)
+}
+
+func (msc *MockSysdConn) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return msc.job("stop "+name+" "+mode, ch)
+}
+
+func (msc *MockSysdConn) KillUnitWithTarget(ctx context.Context, name string, target dbus.Who, signal int32) error {
+	msc.calls = append(msc.calls, fmt.Sprintf("kill %s %s %d", name, target, signal))
+	return msc.error
+}
+
+func (msc *MockSysdConn) ResetFailedUnitContext(ctx context.Context, name string) error {
+	msc.calls = append(msc.calls, "reset-failed "+name)
+	return msc.error
 }
 
 func (msc *MockSysdConn) ListUnitsContext(context.Context) ([]dbus.UnitStatus, error) {
@@ -23,10 +63,16 @@ func (msc *MockSysdConn) ListUnitsContext(context.Context) ([]dbus.UnitStatus, e
 }
 
 func (msc *MockSysdConn) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
-	go func() {
-		ch <- msc.outputString
-	}()
-	return msc.code, msc.error
+	return msc.job("restart "+name+" "+mode, ch)
+}
+
+func (msc *MockSysdConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]interface{}, error) {
+	return msc.unitProps, msc.error
+}
+
+func (msc *MockSysdConn) GetUnitTypePropertiesContext(ctx context.Context, unit string, unitType string) (map[string]interface{}, error) {
+	msc.unitTypeCalled = true
+	return msc.unitTypeProps, msc.error
 }
 
 func TestExists(t *testing.T) {
@@ -56,10 +102,85 @@ func TestRestart(t *testing.T) {
 	}
 	mockConn.code = 1
 	mockConn.outputString = "done"
-	output, err := manager.Restart("test")
+	output, err := manager.Restart("test", "replace", time.Second)
 	assert.Equal(t, "done", output)
 	assert.NoError(t, err)
 	mockConn.error = dummyError
-	output, err = manager.Restart("test")
+	output, err = manager.Restart("test", "replace", time.Second)
+	assert.Error(t, err)
+}
+
+func TestJobs(t *testing.T) {
+	mockConn := &MockSysdConn{outputString: "done"}
+	manager := &SysdManager{
+		conn: mockConn,
+	}
+	for _, job := range []func(string, string, time.Duration) (string, error){manager.Reload, manager.Stop, manager.Start} {
+		output, err := job("test.service", "fail", time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, "done", output)
+	}
+	assert.NoError(t, manager.Kill("test.service", "main", syscall.SIGQUIT, time.Second))
+	assert.NoError(t, manager.ResetFailed("test.service", time.Second))
+	assert.Equal(t, []string{
+		"reload test.service fail",
+		"stop test.service fail",
+		"start test.service fail",
+		"kill test.service main 3",
+		"reset-failed test.service",
+	}, mockConn.calls)
+
+	mockConn.outputString = "dependency"
+	output, err := manager.Start("test.service", "replace", time.Second)
+	assert.Equal(t, "dependency", output)
+	assert.ErrorContains(t, err, `job for test.service finished with result "dependency"`)
+
+	mockConn.noResult = true
+	_, err = manager.Restart("test.service", "replace", 50*time.Millisecond)
+	assert.ErrorContains(t, err, "no result for the job of test.service within 50ms")
+}
+
+func TestState(t *testing.T) {
+	mockConn := &MockSysdConn{}
+	manager := &SysdManager{
+		conn: mockConn,
+	}
+	changed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockConn.unitProps = map[string]interface{}{
+		"ActiveState":          "failed",
+		"SubState":             "failed",
+		"StateChangeTimestamp": uint64(changed.UnixMicro()),
+		"Requires":             []string{"postgresql.service", "sysinit.target"},
+	}
+	mockConn.unitTypeProps = map[string]interface{}{
+		"Result":         "exit-code",
+		"NRestarts":      uint32(3),
+		"ExecMainStatus": int32(1),
+		"MainPID":        uint32(0),
+		"ControlGroup":   "/system.slice/test.service",
+	}
+	state, err := manager.State("test.service")
+	assert.NoError(t, err)
+	assert.Equal(t, &UnitState{
+		Name:                 "test.service",
+		ActiveState:          "failed",
+		SubState:             "failed",
+		StateChangeTimestamp: changed.Local(),
+		Requires:             []string{"postgresql.service", "sysinit.target"},
+		Result:               "exit-code",
+		NRestarts:            3,
+		ExecMainStatus:       1,
+		ControlGroup:         "/system.slice/test.service",
+	}, state)
+
+	mockConn.unitTypeCalled = false
+	state, err = manager.State("test.socket")
+	assert.NoError(t, err)
+	assert.False(t, mockConn.unitTypeCalled)
+	assert.Equal(t, "failed", state.ActiveState)
+	assert.Equal(t, "", state.Result)
+
+	mockConn.error = dummyError
+	_, err = manager.State("test.service")
 	assert.Error(t, err)
 }
@@ -0,0 +1,170 @@
+package sysd
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+)
+
+const unitPathPrefix = "/org/freedesktop/systemd1/unit/"
+
+type UnitEventType int
+
+const (
+	UnitChanged UnitEventType = iota
+	UnitNew
+	UnitRemoved
+)
+
+func (t UnitEventType) String() string {
+	switch t {
+	case UnitChanged:
+		return "changed"
+	case UnitNew:
+		return "new"
+	case UnitRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// UnitEvent is a unit lifecycle signal emitted by systemd. ActiveState and
+// SubState are only set on UnitChanged events that carry them.
+type UnitEvent struct {
+	Type        UnitEventType
+	Unit        string
+	ActiveState string
+	SubState    string
+}
+
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan UnitEvent, error)
+}
+
+// Watch subscribes to the UnitNew, UnitRemoved and PropertiesChanged signals
+// of systemd on a dedicated bus connection. The returned channel is closed
+// once ctx is done or the connection is lost.
+func (s *SysdManager) Watch(ctx context.Context) (<-chan UnitEvent, error) {
+	conn, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	matches := [][]godbus.MatchOption{
+		{godbus.WithMatchInterface("org.freedesktop.systemd1.Manager"), godbus.WithMatchMember("UnitNew")},
+		{godbus.WithMatchInterface("org.freedesktop.systemd1.Manager"), godbus.WithMatchMember("UnitRemoved")},
+		{
+			godbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			godbus.WithMatchMember("PropertiesChanged"),
+			godbus.WithMatchPathNamespace(godbus.ObjectPath(strings.TrimSuffix(unitPathPrefix, "/"))),
+		},
+	}
+	for _, m := range matches {
+		if err := conn.AddMatchSignalContext(ctx, m...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	// systemd only emits unit signals while at least one client is subscribed
+	err = conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1").
+		CallWithContext(ctx, "org.freedesktop.systemd1.Manager.Subscribe", 0).Store()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	signals := make(chan *godbus.Signal, 64)
+	conn.Signal(signals)
+	events := make(chan UnitEvent, 64)
+	go func() {
+		defer close(events)
+		defer conn.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig, ok := <-signals:
+				if !ok {
+					return
+				}
+				ev, ok := parseSignal(sig)
+				if !ok {
+					continue
+				}
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+func parseSignal(sig *godbus.Signal) (UnitEvent, bool) {
+	switch sig.Name {
+	case "org.freedesktop.systemd1.Manager.UnitNew", "org.freedesktop.systemd1.Manager.UnitRemoved":
+		if len(sig.Body) < 1 {
+			return UnitEvent{}, false
+		}
+		name, ok := sig.Body[0].(string)
+		if !ok {
+			return UnitEvent{}, false
+		}
+		ev := UnitEvent{Type: UnitNew, Unit: name}
+		if sig.Name == "org.freedesktop.systemd1.Manager.UnitRemoved" {
+			ev.Type = UnitRemoved
+		}
+		return ev, true
+	case "org.freedesktop.DBus.Properties.PropertiesChanged":
+		if len(sig.Body) < 2 {
+			return UnitEvent{}, false
+		}
+		if iface, _ := sig.Body[0].(string); iface != "org.freedesktop.systemd1.Unit" {
+			return UnitEvent{}, false
+		}
+		changed, ok := sig.Body[1].(map[string]godbus.Variant)
+		if !ok {
+			return UnitEvent{}, false
+		}
+		activeState, ok := changed["ActiveState"]
+		if !ok {
+			return UnitEvent{}, false
+		}
+		name, ok := unitNameFromPath(sig.Path)
+		if !ok {
+			return UnitEvent{}, false
+		}
+		ev := UnitEvent{Type: UnitChanged, Unit: name}
+		ev.ActiveState, _ = activeState.Value().(string)
+		if subState, ok := changed["SubState"]; ok {
+			ev.SubState, _ = subState.Value().(string)
+		}
+		return ev, true
+	}
+	return UnitEvent{}, false
+}
+
+// unitNameFromPath reverses the bus label escaping systemd applies to unit
+// names in object paths, e.g. "nginx_2eservice" is "nginx.service".
+func unitNameFromPath(path godbus.ObjectPath) (string, bool) {
+	label, ok := strings.CutPrefix(string(path), unitPathPrefix)
+	if !ok || label == "" {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		if label[i] == '_' && i+2 < len(label) {
+			if c, err := hex.DecodeString(label[i+1 : i+3]); err == nil {
+				b.Write(c)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(label[i])
+	}
+	return b.String(), true
+}
@@ -0,0 +1,112 @@
+package sysd
+
+import (
+	"testing"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitNameFromPath(t *testing.T) {
+	tests := []struct {
+		path     godbus.ObjectPath
+		expected string
+		ok       bool
+	}{
+		{"/org/freedesktop/systemd1/unit/nginx_2eservice", "nginx.service", true},
+		{"/org/freedesktop/systemd1/unit/getty_40tty1_2eservice", "getty@tty1.service", true},
+		{"/org/freedesktop/systemd1/unit/my_2dapp_2eservice", "my-app.service", true},
+		{"/org/freedesktop/systemd1/unit/", "", false},
+		{"/org/freedesktop/systemd1", "", false},
+	}
+	for _, tt := range tests {
+		name, ok := unitNameFromPath(tt.path)
+		assert.Equal(t, tt.ok, ok, string(tt.path))
+		assert.Equal(t, tt.expected, name)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name     string
+		signal   *godbus.Signal
+		expected UnitEvent
+		ok       bool
+	}{
+		{
+			name: "unit new",
+			signal: &godbus.Signal{
+				Name: "org.freedesktop.systemd1.Manager.UnitNew",
+				Body: []interface{}{"nginx.service", godbus.ObjectPath("/org/freedesktop/systemd1/unit/nginx_2eservice")},
+			},
+			expected: UnitEvent{Type: UnitNew, Unit: "nginx.service"},
+			ok:       true,
+		},
+		{
+			name: "unit removed",
+			signal: &godbus.Signal{
+				Name: "org.freedesktop.systemd1.Manager.UnitRemoved",
+				Body: []interface{}{"nginx.service", godbus.ObjectPath("/org/freedesktop/systemd1/unit/nginx_2eservice")},
+			},
+			expected: UnitEvent{Type: UnitRemoved, Unit: "nginx.service"},
+			ok:       true,
+		},
+		{
+			name: "active state changed",
+			signal: &godbus.Signal{
+				Path: "/org/freedesktop/systemd1/unit/nginx_2eservice",
+				Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+				Body: []interface{}{
+					"org.freedesktop.systemd1.Unit",
+					map[string]godbus.Variant{
+						"ActiveState": godbus.MakeVariant("failed"),
+						"SubState":    godbus.MakeVariant("failed"),
+					},
+					[]string{},
+				},
+			},
+			expected: UnitEvent{Type: UnitChanged, Unit: "nginx.service", ActiveState: "failed", SubState: "failed"},
+			ok:       true,
+		},
+		{
+			name: "unrelated property",
+			signal: &godbus.Signal{
+				Path: "/org/freedesktop/systemd1/unit/nginx_2eservice",
+				Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+				Body: []interface{}{
+					"org.freedesktop.systemd1.Unit",
+					map[string]godbus.Variant{"Description": godbus.MakeVariant("nginx")},
+					[]string{},
+				},
+			},
+			ok: false,
+		},
+		{
+			name: "service interface",
+			signal: &godbus.Signal{
+				Path: "/org/freedesktop/systemd1/unit/nginx_2eservice",
+				Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+				Body: []interface{}{
+					"org.freedesktop.systemd1.Service",
+					map[string]godbus.Variant{"ActiveState": godbus.MakeVariant("active")},
+					[]string{},
+				},
+			},
+			ok: false,
+		},
+		{
+			name:   "job removed",
+			signal: &godbus.Signal{Name: "org.freedesktop.systemd1.Manager.JobRemoved"},
+			ok:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, ok := parseSignal(tt.signal)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expected, ev)
+			}
+		})
+	}
+}